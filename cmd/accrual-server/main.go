@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	accrualApp "github.com/zvfkjytytw/gophmarkt/internal/accrual/app"
+)
+
+const (
+	envRunAddress  = "RUN_ADDRESS"
+	envDatabaseURI = "DATABASE_URI"
+	envStorageType = "STORAGE_TYPE"
+)
+
+func main() {
+	var (
+		runAddress  string
+		databaseURI string
+		storageType string
+	)
+
+	flag.StringVar(&runAddress, "a", "localhost:8081", "address and port of the service launch")
+	flag.StringVar(&databaseURI, "d", "", "address of the database connection")
+	flag.StringVar(&storageType, "s", "postgres", "storage type: postgres or memory")
+	flag.Parse()
+
+	value, ok := os.LookupEnv(envRunAddress)
+	if ok {
+		runAddress = value
+	}
+
+	value, ok = os.LookupEnv(envDatabaseURI)
+	if ok {
+		databaseURI = value
+	}
+
+	value, ok = os.LookupEnv(envStorageType)
+	if ok {
+		storageType = value
+	}
+
+	app, err := accrualApp.NewApp(runAddress, databaseURI, storageType)
+	if err != nil {
+		panic(err)
+	}
+
+	app.Run(context.Background())
+}
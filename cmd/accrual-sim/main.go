@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	sim "github.com/zvfkjytytw/gophmarkt/internal/accrual/sim"
+)
+
+const (
+	envRunAddress = "RUN_ADDRESS"
+	envRateLimit  = "RATE_LIMIT"
+)
+
+func main() {
+	var (
+		configFile string
+		runAddress string
+		rateLimit  int
+	)
+
+	flag.StringVar(&configFile, "c", "", "simulator config file with the rules and the orders")
+	flag.StringVar(&runAddress, "a", "", "address and port of the simulator launch")
+	flag.IntVar(&rateLimit, "l", -1, "requests per minute to the order status, 0 means no limit")
+	flag.Parse()
+
+	value, ok := os.LookupEnv(envRunAddress)
+	if ok {
+		runAddress = value
+	}
+
+	value, ok = os.LookupEnv(envRateLimit)
+	if ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			panic(fmt.Errorf("failed parse %s: %v", envRateLimit, err))
+		}
+		rateLimit = limit
+	}
+
+	config := &sim.Config{}
+	if configFile != "" {
+		var err error
+		config, err = sim.ReadConfigFile(configFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if runAddress != "" {
+		config.Address = runAddress
+	}
+
+	if rateLimit >= 0 {
+		config.RateLimit = rateLimit
+	}
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+
+	simulator, err := sim.NewSimulator(config, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		simulator.Stop(context.Background())
+	}()
+
+	if err = simulator.Start(ctx); err != nil {
+		logger.Fatal("accrual simulator stopped", zap.Error(err))
+	}
+}
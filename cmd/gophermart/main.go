@@ -2,69 +2,44 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 
 	serverApp "github.com/zvfkjytytw/gophmarkt/internal/server/app"
+	gophmarktconfig "github.com/zvfkjytytw/gophmarkt/internal/server/config"
 )
 
-const (
-	envRunAddress    = "RUN_ADDRESS"
-	envDatabaseURI   = "DATABASE_URI"
-	envAccuralSystem = "ACCRUAL_SYSTEM_ADDRESS"
-	envMigrationDir  = "MIGRATION_DIR"
-)
+const commandMigrate = "migrate"
 
 func main() {
-	var (
-		configFile    string
-		runAddress    string
-		databaseURI   string
-		accrualSystem string
-		migrationDir  string
-	)
-
-	flag.StringVar(&configFile, "c", "../../build/server.yaml", "server config file")
-	flag.StringVar(&runAddress, "a", "localhost:8080", "address and port of the service launch")
-	flag.StringVar(&databaseURI, "d", "", "address of the database connection")
-	flag.StringVar(&accrualSystem, "r", "", "address of the accrual calculation system")
-	flag.StringVar(&migrationDir, "m", "../../build/migrations", "directory with the migration files")
-	flag.Parse()
-
-	value, ok := os.LookupEnv(envRunAddress)
-	if ok {
-		runAddress = value
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == commandMigrate {
+		if err := runMigrate(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	value, ok = os.LookupEnv(envDatabaseURI)
-	if ok {
-		databaseURI = value
+	config, rest, err := gophmarktconfig.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	value, ok = os.LookupEnv(envAccuralSystem)
-	if ok {
-		accrualSystem = value
+	if err != nil {
+		panic(err)
 	}
 
-	value, ok = os.LookupEnv(envMigrationDir)
-	if ok {
-		migrationDir = value
+	if len(rest) > 0 {
+		panic(fmt.Errorf("unknown command %s", rest[0]))
 	}
 
-	app, err := serverApp.NewApp(
-		runAddress,
-		databaseURI,
-		accrualSystem,
-	)
+	app, err := serverApp.NewApp(config)
 	if err != nil {
 		panic(err)
 	}
 
-	// app, err := serverApp.NewAppFromFile(configFile)
-	// if err != nil {
-	// 	panic(err)
-	// }
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
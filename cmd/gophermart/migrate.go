@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	gophmarktconfig "github.com/zvfkjytytw/gophmarkt/internal/server/config"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const migrateUsage = "usage: gophermart migrate [flags] up | down [steps] | status | force <version>"
+
+// runMigrate manages the database schema: gophermart migrate [flags] <command> [argument].
+func runMigrate(args []string) error {
+	config, rest, err := gophmarktconfig.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(migrateUsage)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(rest) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if config.StorageType != storage.TypePostgres {
+		return fmt.Errorf("migrations are applied only to the %s storage", storage.TypePostgres)
+	}
+
+	dsn, err := storage.GetDSNFromConfig(config.StorageConfig)
+	if err != nil {
+		return fmt.Errorf("failed format dsn: %v", err)
+	}
+
+	migrator, err := storage.NewMigrator(dsn)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	command, rest := rest[0], rest[1:]
+	switch {
+	case command == "up" && len(rest) == 0:
+		err = migrator.Up()
+	case command == "down" && len(rest) <= 1:
+		steps := 1
+		if len(rest) == 1 {
+			if steps, err = strconv.Atoi(rest[0]); err != nil {
+				return fmt.Errorf("invalid number of steps %s", rest[0])
+			}
+		}
+		err = migrator.Down(steps)
+	case command == "force" && len(rest) == 1:
+		version, parseErr := strconv.Atoi(rest[0])
+		if parseErr != nil {
+			return fmt.Errorf("invalid version %s", rest[0])
+		}
+		err = migrator.Force(version)
+	case command == "status" && len(rest) == 0:
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d\ndirty: %t\nlatest: %d\n", status.Version, status.Dirty, status.Latest)
+	if err = status.Check(); err != nil {
+		return err
+	}
+
+	if status.Pending() {
+		fmt.Println("pending migrations, run: gophermart migrate up")
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package gophmarktaccrualapp
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	server "github.com/zvfkjytytw/gophmarkt/internal/accrual/http"
+	processor "github.com/zvfkjytytw/gophmarkt/internal/accrual/processor"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/accrual/storage"
+)
+
+type Service interface {
+	Start(context.Context) error
+	Stop(context.Context) error
+}
+
+// App is the accrual calculation service: the registration API and the calculation of the orders.
+type App struct {
+	services []Service
+	storage  storage.Storage
+	logger   *zap.Logger
+}
+
+func NewApp(runAddress, databaseURI, storageType string) (*App, error) {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return nil, fmt.Errorf("failed init logger: %v", err)
+	}
+
+	var appStorage storage.Storage
+	switch storageType {
+	case storage.TypeMemory:
+		appStorage = storage.NewMemStorage()
+	case storage.TypePostgres, "":
+		pgStorage, err := storage.NewPGStorage(databaseURI)
+		if err != nil {
+			return nil, fmt.Errorf("failed init storage: %v", err)
+		}
+
+		if err := pgStorage.ApplyMigrations(); err != nil {
+			return nil, fmt.Errorf("failed init DB: %v", err)
+		}
+		appStorage = pgStorage
+	default:
+		return nil, fmt.Errorf("unknown storage type %s", storageType)
+	}
+
+	return &App{
+		services: []Service{
+			server.NewHTTPServer(runAddress, logger, appStorage),
+			processor.NewProcessor(appStorage, logger),
+		},
+		storage: appStorage,
+		logger:  logger,
+	}, nil
+}
+
+// Run starts the services and stops them by a signal or the first failed service.
+func (a *App) Run(ctx context.Context) {
+	defer a.logger.Sync()
+
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	for _, service := range a.services {
+		go func(service Service) {
+			if err := service.Start(ctx); err != nil {
+				a.logger.Sugar().Errorf("service failed: %v", err)
+				cancel()
+			}
+		}(service)
+	}
+
+	<-ctx.Done()
+	a.logger.Info("accrual service is stopping")
+
+	for _, service := range a.services {
+		if err := service.Stop(context.Background()); err != nil {
+			a.logger.Sugar().Errorf("failed stop service: %v", err)
+		}
+	}
+
+	if err := a.storage.Close(); err != nil {
+		a.logger.Sugar().Errorf("failed close storage: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package gophmarktaccrualhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	luhn "github.com/EClaesson/go-luhn"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	rules "github.com/zvfkjytytw/gophmarkt/internal/accrual/rules"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/accrual/storage"
+)
+
+type HTTPServer struct {
+	server  *http.Server
+	logger  *zap.Logger
+	storage storage.Storage
+}
+
+func NewHTTPServer(runAddress string, logger *zap.Logger, storage storage.Storage) *HTTPServer {
+	return &HTTPServer{
+		server: &http.Server{
+			Addr:         runAddress,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 5 * time.Second,
+			IdleTimeout:  10 * time.Second,
+		},
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+func (h *HTTPServer) Start(ctx context.Context) error {
+	h.server.Handler = h.newRouter()
+
+	err := h.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed start accrual http server: %v", err)
+	}
+
+	return nil
+}
+
+func (h *HTTPServer) Stop(ctx context.Context) error {
+	return h.server.Shutdown(ctx)
+}
+
+func (h *HTTPServer) newRouter() chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.StripSlashes)
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Recoverer)
+
+	// getting the accrual state of the order
+	r.Get("/api/orders/{number}", h.orderGet)
+	// registration of the order with its goods
+	r.Post("/api/orders", h.orderPost)
+	// registration of the reward rule
+	r.Post("/api/goods", h.goodsPost)
+
+	return r
+}
+
+func (h *HTTPServer) orderGet(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+	state, err := h.storage.GetOrder(r.Context(), number)
+	if errors.Is(err, storage.ErrOrderNotFound) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err != nil {
+		h.logger.Sugar().Errorf("failed get order %s: %v", number, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.Marshal(state)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshal order %s: %v", number, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (h *HTTPServer) orderPost(w http.ResponseWriter, r *http.Request) {
+	order := &storage.Order{}
+	if err := readJSON(r, order); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if valid, err := luhn.IsValid(order.Number); err != nil || !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid order number"))
+		return
+	}
+
+	err := h.storage.AddOrder(r.Context(), order)
+	if errors.Is(err, storage.ErrOrderExists) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err != nil {
+		h.logger.Sugar().Errorf("failed register order %s: %v", order.Number, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *HTTPServer) goodsPost(w http.ResponseWriter, r *http.Request) {
+	rule := &rules.Rule{}
+	if err := readJSON(r, rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err := rule.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	err := h.storage.AddRule(r.Context(), rule)
+	if errors.Is(err, storage.ErrRuleExists) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err != nil {
+		h.logger.Sugar().Errorf("failed register rule %s: %v", rule.Match, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed read body: %v", err)
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed unmarshal body: %v", err)
+	}
+
+	return nil
+}
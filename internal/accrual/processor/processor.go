@@ -0,0 +1,90 @@
+package gophmarktprocessor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/accrual/storage"
+)
+
+const (
+	processInterval = 500 * time.Millisecond
+	processBatch    = 100
+	// time after which an order left in PROCESSING by a failed instance is calculated again
+	processStale = time.Minute
+)
+
+// Processor calculates the accrual of the registered orders with the current reward rules.
+// The order without rewarded goods becomes INVALID.
+type Processor struct {
+	storage storage.Storage
+	logger  *zap.Logger
+	stop    chan struct{}
+}
+
+func NewProcessor(storage storage.Storage, logger *zap.Logger) *Processor {
+	return &Processor{
+		storage: storage,
+		logger:  logger,
+		stop:    make(chan struct{}),
+	}
+}
+
+func (p *Processor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(processInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.process(ctx)
+		}
+	}
+}
+
+func (p *Processor) Stop(ctx context.Context) error {
+	close(p.stop)
+
+	return nil
+}
+
+func (p *Processor) process(ctx context.Context) {
+	orders, err := p.storage.ClaimOrders(ctx, processBatch, processStale)
+	if err != nil {
+		p.logger.Sugar().Errorf("failed claim registered orders: %v", err)
+		return
+	}
+
+	if len(orders) == 0 {
+		return
+	}
+
+	rules, err := p.storage.GetRules(ctx)
+	if err != nil {
+		p.logger.Sugar().Errorf("failed get reward rules: %v", err)
+		return
+	}
+
+	for _, order := range orders {
+		state := &storage.OrderState{
+			Order:  order.Number,
+			Status: storage.StatusInvalid,
+		}
+
+		accrual, matched := rules.Calculate(order.Goods)
+		if matched {
+			state.Status = storage.StatusProcessed
+			state.Accrual = accrual
+		}
+
+		if err := p.storage.FinishOrder(ctx, state); err != nil {
+			p.logger.Sugar().Errorf("failed finish order %s: %v", order.Number, err)
+		}
+	}
+}
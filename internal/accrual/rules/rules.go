@@ -0,0 +1,123 @@
+package gophmarktrules
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+type RewardType string
+
+const (
+	// reward is a percent of the good price
+	RewardPercent RewardType = "%"
+	// reward is a fixed amount of points
+	RewardPoints RewardType = "pt"
+
+	percentScale = 100 * 100
+)
+
+var ErrInvalidRule = errors.New("invalid reward rule")
+
+// Rule rewards every good whose description contains Match.
+type Rule struct {
+	Match      string         `json:"match" yaml:"match"`
+	Reward     storage.Points `json:"reward" yaml:"reward"`
+	RewardType RewardType     `json:"reward_type" yaml:"reward_type"`
+}
+
+type Good struct {
+	Description string         `json:"description" yaml:"description"`
+	Price       storage.Points `json:"price" yaml:"price"`
+}
+
+func (r *Rule) Validate() error {
+	if strings.TrimSpace(r.Match) == "" {
+		return fmt.Errorf("%w: empty match", ErrInvalidRule)
+	}
+
+	if r.Reward <= 0 {
+		return fmt.Errorf("%w: reward %s for %s is not positive", ErrInvalidRule, r.Reward, r.Match)
+	}
+
+	switch r.RewardType {
+	case RewardPercent, RewardPoints:
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown reward type %q for %s", ErrInvalidRule, r.RewardType, r.Match)
+}
+
+// Matches compares the description with the rule ignoring the case.
+func (r *Rule) Matches(description string) bool {
+	return strings.Contains(strings.ToLower(description), strings.ToLower(r.Match))
+}
+
+// Calculate returns the reward for one good at the price.
+// The percent reward is rounded to hundredths half away from zero.
+func (r *Rule) Calculate(price storage.Points) storage.Points {
+	if r.RewardType == RewardPoints {
+		return r.Reward
+	}
+
+	value := int64(price) * int64(r.Reward)
+	quo, rem := value/percentScale, value%percentScale
+	if rem*2 >= percentScale {
+		quo++
+	} else if rem*2 <= -percentScale {
+		quo--
+	}
+
+	return storage.Points(quo)
+}
+
+// Rules is an ordered set of rules, a good is rewarded by the first matching one.
+type Rules []*Rule
+
+func (rs Rules) Validate() error {
+	seen := make(map[string]bool, len(rs))
+	for _, rule := range rs {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+
+		match := strings.ToLower(rule.Match)
+		if seen[match] {
+			return fmt.Errorf("%w: match %s is duplicated", ErrInvalidRule, rule.Match)
+		}
+		seen[match] = true
+	}
+
+	return nil
+}
+
+// Find returns the first rule matching the description.
+func (rs Rules) Find(description string) *Rule {
+	for _, rule := range rs {
+		if rule.Matches(description) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// Calculate sums the rewards of the goods.
+// The second value reports whether any good is rewarded at all.
+func (rs Rules) Calculate(goods []Good) (storage.Points, bool) {
+	var total storage.Points
+	matched := false
+	for _, good := range goods {
+		rule := rs.Find(good.Description)
+		if rule == nil {
+			continue
+		}
+
+		total += rule.Calculate(good.Price)
+		matched = true
+	}
+
+	return total, matched
+}
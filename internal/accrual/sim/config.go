@@ -0,0 +1,73 @@
+package gophmarktsim
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	rules "github.com/zvfkjytytw/gophmarkt/internal/accrual/rules"
+)
+
+const (
+	defaultAddress         = "localhost:8081"
+	defaultProcessingAfter = 500
+	defaultProcessedAfter  = 2000
+	defaultRetryAfter      = 60
+)
+
+type Config struct {
+	// address and port of the simulator launch
+	Address string `yaml:"address"`
+	// reward rules applied to the goods of the orders
+	Rules rules.Rules `yaml:"rules"`
+	// orders known to the simulator at the start
+	Orders []*Order `yaml:"orders"`
+	// time in milliseconds after the registration when the order becomes PROCESSING
+	ProcessingAfter int32 `yaml:"processing_after"`
+	// time in milliseconds after the registration when the order gets its final status
+	ProcessedAfter int32 `yaml:"processed_after"`
+	// bounds in milliseconds of the random delay added to every answer
+	LatencyMin int32 `yaml:"latency_min"`
+	LatencyMax int32 `yaml:"latency_max"`
+	// requests per minute to the order status, 0 means no limit
+	RateLimit int `yaml:"rate_limit"`
+}
+
+// Order is an order registered in the simulator with its goods.
+type Order struct {
+	Number string       `json:"order" yaml:"order"`
+	Goods  []rules.Good `json:"goods" yaml:"goods"`
+}
+
+func ReadConfigFile(configFile string) (*Config, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed read config file %s: %v", configFile, err)
+	}
+
+	config := &Config{}
+	if err = yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed unmarshalling config file %s: %v", configFile, err)
+	}
+
+	return config, nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Address == "" {
+		c.Address = defaultAddress
+	}
+
+	if c.ProcessingAfter <= 0 {
+		c.ProcessingAfter = defaultProcessingAfter
+	}
+
+	if c.ProcessedAfter < c.ProcessingAfter {
+		c.ProcessedAfter = c.ProcessingAfter + defaultProcessedAfter - defaultProcessingAfter
+	}
+
+	if c.LatencyMax < c.LatencyMin {
+		c.LatencyMax = c.LatencyMin
+	}
+}
@@ -0,0 +1,41 @@
+package gophmarktsim
+
+import (
+	"sync"
+	"time"
+)
+
+// windowLimiter allows a fixed number of requests per calendar minute.
+type windowLimiter struct {
+	sync.Mutex
+	limit       int
+	windowStart time.Time
+	count       int
+}
+
+func newWindowLimiter(limit int) *windowLimiter {
+	return &windowLimiter{limit: limit}
+}
+
+// allow counts the request and returns the time left to the next window when it is over the limit.
+func (l *windowLimiter) allow(now time.Time) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	window := now.Truncate(time.Minute)
+	if !window.Equal(l.windowStart) {
+		l.windowStart = window
+		l.count = 0
+	}
+
+	if l.count >= l.limit {
+		return false, window.Add(time.Minute).Sub(now)
+	}
+	l.count++
+
+	return true, 0
+}
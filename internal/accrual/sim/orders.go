@@ -0,0 +1,145 @@
+package gophmarktsim
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	rules "github.com/zvfkjytytw/gophmarkt/internal/accrual/rules"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+type OrderStatus string
+
+const (
+	StatusRegistered OrderStatus = "REGISTERED"
+	StatusProcessing OrderStatus = "PROCESSING"
+	StatusInvalid    OrderStatus = "INVALID"
+	StatusProcessed  OrderStatus = "PROCESSED"
+)
+
+var (
+	errOrderExists = errors.New("order already registered")
+	errRuleExists  = errors.New("reward rule already registered")
+)
+
+// OrderState is the answer of the simulator about the order.
+type OrderState struct {
+	Order   string         `json:"order"`
+	Status  OrderStatus    `json:"status"`
+	Accrual storage.Points `json:"accrual,omitempty"`
+}
+
+type simOrder struct {
+	goods        []rules.Good
+	registeredAt time.Time
+	final        *OrderState
+}
+
+// book keeps the rules and the orders of the simulator.
+// The order status is derived from the time passed since its registration,
+// the reward is calculated once with the rules in force when the final status is reached.
+// The order without rewarded goods ends as INVALID.
+type book struct {
+	sync.Mutex
+	rules           rules.Rules
+	orders          map[string]*simOrder
+	processingAfter time.Duration
+	processedAfter  time.Duration
+}
+
+func newBook(config *Config) (*book, error) {
+	if err := config.Rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	b := &book{
+		rules:           config.Rules,
+		orders:          make(map[string]*simOrder, len(config.Orders)),
+		processingAfter: time.Duration(config.ProcessingAfter) * time.Millisecond,
+		processedAfter:  time.Duration(config.ProcessedAfter) * time.Millisecond,
+	}
+
+	for _, order := range config.Orders {
+		if err := b.addOrder(order, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func (b *book) addOrder(order *Order, now time.Time) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.orders[order.Number]; ok {
+		return errOrderExists
+	}
+
+	b.orders[order.Number] = &simOrder{
+		goods:        order.Goods,
+		registeredAt: now,
+	}
+
+	return nil
+}
+
+func (b *book) addRule(rule *rules.Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	for _, r := range b.rules {
+		if r.Match == rule.Match {
+			return errRuleExists
+		}
+	}
+	b.rules = append(b.rules, rule)
+
+	return nil
+}
+
+// state returns the state of the order at the moment, false for the unknown order.
+func (b *book) state(number string, now time.Time) (*OrderState, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	order, ok := b.orders[number]
+	if !ok {
+		return nil, false
+	}
+
+	if order.final != nil {
+		state := *order.final
+		return &state, true
+	}
+
+	state := &OrderState{Order: number}
+	elapsed := now.Sub(order.registeredAt)
+	switch {
+	case elapsed < b.processingAfter:
+		state.Status = StatusRegistered
+	case elapsed < b.processedAfter:
+		state.Status = StatusProcessing
+	default:
+		accrual, matched := b.rules.Calculate(order.goods)
+		if !matched {
+			state.Status = StatusInvalid
+			break
+		}
+
+		state.Status = StatusProcessed
+		state.Accrual = accrual
+	}
+
+	if state.Status == StatusInvalid || state.Status == StatusProcessed {
+		final := *state
+		order.final = &final
+	}
+
+	return state, true
+}
@@ -0,0 +1,202 @@
+package gophmarktsim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	luhn "github.com/EClaesson/go-luhn"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	rules "github.com/zvfkjytytw/gophmarkt/internal/accrual/rules"
+)
+
+// Simulator imitates the accrual system for the local runs and the tests.
+type Simulator struct {
+	server     *http.Server
+	logger     *zap.Logger
+	book       *book
+	limiter    *windowLimiter
+	latencyMin time.Duration
+	latencyMax time.Duration
+}
+
+func NewSimulator(config *Config, logger *zap.Logger) (*Simulator, error) {
+	config.setDefaults()
+
+	book, err := newBook(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed init orders: %v", err)
+	}
+
+	return &Simulator{
+		server: &http.Server{
+			Addr:        config.Address,
+			ReadTimeout: 5 * time.Second,
+			IdleTimeout: 10 * time.Second,
+		},
+		logger:     logger,
+		book:       book,
+		limiter:    newWindowLimiter(config.RateLimit),
+		latencyMin: time.Duration(config.LatencyMin) * time.Millisecond,
+		latencyMax: time.Duration(config.LatencyMax) * time.Millisecond,
+	}, nil
+}
+
+func (s *Simulator) Start(ctx context.Context) error {
+	s.server.Handler = s.newRouter()
+
+	s.logger.Sugar().Infof("accrual simulator listens on %s", s.server.Addr)
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed start accrual simulator: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Simulator) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Simulator) newRouter() chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.StripSlashes)
+	r.Use(middleware.Recoverer)
+	r.Use(s.latency)
+
+	// getting the accrual state of the order
+	r.Get("/api/orders/{number}", s.orderGet)
+	// registration of the order with its goods
+	r.Post("/api/orders", s.orderPost)
+	// registration of the reward rule
+	r.Post("/api/goods", s.goodsPost)
+
+	return r
+}
+
+// latency delays every answer for a random time within the configured bounds.
+func (s *Simulator) latency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay := s.latencyMin
+		if spread := s.latencyMax - s.latencyMin; spread > 0 {
+			delay += time.Duration(rand.Int63n(int64(spread)))
+		}
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Simulator) orderGet(w http.ResponseWriter, r *http.Request) {
+	ok, wait := s.limiter.allow(time.Now())
+	if !ok {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(fmt.Sprintf("No more than %d requests per minute allowed", s.limiter.limit)))
+		return
+	}
+
+	state, ok := s.book.state(chi.URLParam(r, "number"), time.Now())
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, err := json.Marshal(state)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed marshal order %s: %v", state.Order, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (s *Simulator) orderPost(w http.ResponseWriter, r *http.Request) {
+	order := &Order{}
+	if err := readJSON(r, order); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if valid, err := luhn.IsValid(order.Number); err != nil || !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid order number"))
+		return
+	}
+
+	err := s.book.addOrder(order, time.Now())
+	if errors.Is(err, errOrderExists) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err != nil {
+		s.logger.Sugar().Errorf("failed register order %s: %v", order.Number, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Simulator) goodsPost(w http.ResponseWriter, r *http.Request) {
+	rule := &rules.Rule{}
+	if err := readJSON(r, rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	err := s.book.addRule(rule)
+	switch {
+	case errors.Is(err, errRuleExists):
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+	case errors.Is(err, rules.ErrInvalidRule):
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+	case err != nil:
+		s.logger.Sugar().Errorf("failed register rule %s: %v", rule.Match, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed read body: %v", err)
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed unmarshal body: %v", err)
+	}
+
+	return nil
+}
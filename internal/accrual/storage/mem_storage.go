@@ -0,0 +1,152 @@
+package gophmarktaccrualstorage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rules "github.com/zvfkjytytw/gophmarkt/internal/accrual/rules"
+)
+
+type memOrder struct {
+	order     Order
+	state     OrderState
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// MemStorage keeps all data in process memory.
+type MemStorage struct {
+	sync.RWMutex
+	orders map[string]*memOrder
+	rules  rules.Rules
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		orders: make(map[string]*memOrder),
+		rules:  make(rules.Rules, 0),
+	}
+}
+
+func (s *MemStorage) AddOrder(ctx context.Context, order *Order) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.orders[order.Number]; ok {
+		return ErrOrderExists
+	}
+
+	now := time.Now()
+	s.orders[order.Number] = &memOrder{
+		order:     *order,
+		state:     OrderState{Order: order.Number, Status: StatusRegistered},
+		createdAt: now,
+		updatedAt: now,
+	}
+
+	return nil
+}
+
+func (s *MemStorage) GetOrder(ctx context.Context, number string) (*OrderState, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	order, ok := s.orders[number]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	state := order.state
+
+	return &state, nil
+}
+
+func (s *MemStorage) ClaimOrders(ctx context.Context, limit int, stale time.Duration) ([]*Order, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	due := make([]*memOrder, 0)
+	for _, order := range s.orders {
+		switch order.state.Status {
+		case StatusRegistered:
+		case StatusProcessing:
+			if now.Sub(order.updatedAt) < stale {
+				continue
+			}
+		default:
+			continue
+		}
+
+		due = append(due, order)
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].createdAt.Before(due[j].createdAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	orders := make([]*Order, 0, len(due))
+	for _, order := range due {
+		order.state.Status = StatusProcessing
+		order.updatedAt = now
+
+		claimed := order.order
+		orders = append(orders, &claimed)
+	}
+
+	return orders, nil
+}
+
+func (s *MemStorage) FinishOrder(ctx context.Context, state *OrderState) error {
+	s.Lock()
+	defer s.Unlock()
+
+	order, ok := s.orders[state.Order]
+	if !ok {
+		return ErrOrderNotFound
+	}
+
+	order.state = *state
+	order.updatedAt = time.Now()
+
+	return nil
+}
+
+func (s *MemStorage) AddRule(ctx context.Context, rule *rules.Rule) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, r := range s.rules {
+		if strings.EqualFold(r.Match, rule.Match) {
+			return ErrRuleExists
+		}
+	}
+
+	added := *rule
+	s.rules = append(s.rules, &added)
+
+	return nil
+}
+
+func (s *MemStorage) GetRules(ctx context.Context) (rules.Rules, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make(rules.Rules, 0, len(s.rules))
+	for _, rule := range s.rules {
+		r := *rule
+		list = append(list, &r)
+	}
+
+	return list, nil
+}
+
+func (s *MemStorage) Close() error {
+	return nil
+}
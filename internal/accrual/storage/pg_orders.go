@@ -0,0 +1,145 @@
+package gophmarktaccrualstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func (s *PGStorage) AddOrder(ctx context.Context, order *Order) error {
+	goods, err := json.Marshal(order.Goods)
+	if err != nil {
+		return fmt.Errorf("failed marshal goods of order %s: %v", order.Number, err)
+	}
+
+	now := time.Now()
+	query, args, err := sq.Insert(ordersTable).Columns("order_id", "goods", "status", "created_at", "updated_at").
+		Values(order.Number, goods, StatusRegistered, now, now).
+		Suffix("ON CONFLICT (order_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate insert order query for order %s: %v", order.Number, err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed execute insert order query for order %s: %v", order.Number, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed get count of the affected rows: %v", err)
+	}
+
+	if n == 0 {
+		return ErrOrderExists
+	}
+
+	return nil
+}
+
+func (s *PGStorage) GetOrder(ctx context.Context, number string) (*OrderState, error) {
+	query, args, err := sq.Select("status", "accrual").From(ordersTable).
+		Where(sq.Eq{"order_id": number}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select order query for order %s: %v", number, err)
+	}
+
+	state := &OrderState{Order: number}
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&state.Status, &state.Accrual)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed get order %s: %v", number, err)
+	}
+
+	return state, nil
+}
+
+func (s *PGStorage) ClaimOrders(ctx context.Context, limit int, stale time.Duration) ([]*Order, error) {
+	now := time.Now()
+	due := sq.Select("order_id").From(ordersTable).
+		Where(sq.Or{
+			sq.Eq{"status": StatusRegistered},
+			sq.And{sq.Eq{"status": StatusProcessing}, sq.Lt{"updated_at": now.Add(-stale)}},
+		}).
+		OrderBy("created_at").Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	query, args, err := sq.Update(ordersTable).
+		Set("status", StatusProcessing).
+		Set("updated_at", now).
+		Where(sq.Expr("order_id IN (?)", due)).
+		Suffix("RETURNING order_id, goods").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate claim orders query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute claim orders query: %v", err)
+	}
+	defer rows.Close()
+
+	orders := make([]*Order, 0, limit)
+	for rows.Next() {
+		var goods []byte
+		order := &Order{}
+		if err = rows.Scan(&order.Number, &goods); err != nil {
+			return nil, fmt.Errorf("failed scan claimed order: %v", err)
+		}
+
+		if err = json.Unmarshal(goods, &order.Goods); err != nil {
+			return nil, fmt.Errorf("failed unmarshal goods of order %s: %v", order.Number, err)
+		}
+
+		orders = append(orders, order)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan claimed orders rows: %v", rows.Err())
+	}
+
+	return orders, nil
+}
+
+func (s *PGStorage) FinishOrder(ctx context.Context, state *OrderState) error {
+	var accrual interface{}
+	if state.Status == StatusProcessed {
+		accrual = state.Accrual
+	}
+
+	query, args, err := sq.Update(ordersTable).
+		Set("status", state.Status).
+		Set("accrual", accrual).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"order_id": state.Order}).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate update order query for order %s: %v", state.Order, err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed execute update order query for order %s: %v", state.Order, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed get count of the affected rows: %v", err)
+	}
+
+	if n != 1 {
+		return ErrOrderNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package gophmarktaccrualstorage
+
+import (
+	"context"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+
+	rules "github.com/zvfkjytytw/gophmarkt/internal/accrual/rules"
+)
+
+func (s *PGStorage) AddRule(ctx context.Context, rule *rules.Rule) error {
+	query, args, err := sq.Insert(rulesTable).Columns("match", "reward", "reward_type").
+		Values(rule.Match, rule.Reward, rule.RewardType).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate insert rule query for %s: %v", rule.Match, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, query, args...)
+	if isUniqueViolation(err) {
+		return ErrRuleExists
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed execute insert rule query for %s: %v", rule.Match, err)
+	}
+
+	return nil
+}
+
+func (s *PGStorage) GetRules(ctx context.Context) (rules.Rules, error) {
+	query, args, err := sq.Select("match", "reward", "reward_type").From(rulesTable).
+		OrderBy("rule_id").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select rules query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute select rules query: %v", err)
+	}
+	defer rows.Close()
+
+	list := make(rules.Rules, 0)
+	for rows.Next() {
+		rule := &rules.Rule{}
+		if err = rows.Scan(&rule.Match, &rule.Reward, &rule.RewardType); err != nil {
+			return nil, fmt.Errorf("failed scan rule: %v", err)
+		}
+
+		list = append(list, rule)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan rules rows: %v", rows.Err())
+	}
+
+	return list, nil
+}
@@ -0,0 +1,62 @@
+package gophmarktaccrualstorage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	rules "github.com/zvfkjytytw/gophmarkt/internal/accrual/rules"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+type OrderStatus string
+
+const (
+	TypePostgres = "postgres"
+	TypeMemory   = "memory"
+
+	StatusRegistered OrderStatus = "REGISTERED"
+	StatusProcessing OrderStatus = "PROCESSING"
+	StatusInvalid    OrderStatus = "INVALID"
+	StatusProcessed  OrderStatus = "PROCESSED"
+)
+
+var (
+	ErrOrderExists   = errors.New("order already registered")
+	ErrOrderNotFound = errors.New("order not registered")
+	ErrRuleExists    = errors.New("reward rule already registered")
+)
+
+// Order is an order registered for the calculation with its goods.
+type Order struct {
+	Number string       `json:"order"`
+	Goods  []rules.Good `json:"goods"`
+}
+
+// OrderState is the state of the calculation of the order.
+type OrderState struct {
+	Order   string         `json:"order"`
+	Status  OrderStatus    `json:"status"`
+	Accrual storage.Points `json:"accrual,omitempty"`
+}
+
+// Storage is the set of operations the accrual service needs from a backend.
+type Storage interface {
+	// orders
+	AddOrder(ctx context.Context, order *Order) error
+	GetOrder(ctx context.Context, number string) (*OrderState, error)
+	// ClaimOrders moves up to limit registered orders to PROCESSING,
+	// the orders stuck in PROCESSING longer than stale are claimed again.
+	ClaimOrders(ctx context.Context, limit int, stale time.Duration) ([]*Order, error)
+	FinishOrder(ctx context.Context, state *OrderState) error
+	// reward rules
+	AddRule(ctx context.Context, rule *rules.Rule) error
+	GetRules(ctx context.Context) (rules.Rules, error)
+
+	Close() error
+}
+
+var (
+	_ Storage = (*PGStorage)(nil)
+	_ Storage = (*MemStorage)(nil)
+)
@@ -2,32 +2,45 @@ package gophmarktaccrual
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
 	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+	tracing "github.com/zvfkjytytw/gophmarkt/internal/server/tracing"
 )
 
 type OrderStatus string
 
 type AccrualOrder struct {
-	Order   string      `json:"order"`
-	Status  OrderStatus `json:"status"`
-	Accrual float64     `json:"accrual"`
+	Order   string         `json:"order"`
+	Status  OrderStatus    `json:"status"`
+	Accrual storage.Points `json:"accrual"`
 }
 
 const (
-	accrualHandler      = `/api/orders/%s`
-	accrualInterval     = 5000
-	waitAfterToMany     = 1000
-	waitBetweenRequests = 50
+	accrualHandler = `/api/orders/%s`
+	ownerIDLen     = 8
+
+	// attribute of the order number in the spans
+	orderNumberKey = attribute.Key("gophmarkt.order.number")
 
 	orderRegistered OrderStatus = "REGISTERED"
 	orderInvalid    OrderStatus = "INVALID"
@@ -35,140 +48,377 @@ const (
 	orderProcessed  OrderStatus = "PROCESSED"
 )
 
-var errTooManyRequests = errors.New("too many requests")
 var accrualToStorage = map[OrderStatus]storage.OrderStatus{
 	orderInvalid:    storage.OrderStatusInvalid,
 	orderProcessing: storage.OrderStatusProcessing,
 	orderProcessed:  storage.OrderStatusProcessed,
 }
 
+// Accrual polls the accrual system for the unprocessed orders.
+// The due orders are claimed from the storage with a lease and checked by a pool of workers,
+// every order keeps its own schedule with an exponential backoff while it has no progress.
 type Accrual struct {
-	address string
-	client  http.Client
-	storage *storage.PGStorage
-	logger  *zap.Logger
-	stop    chan struct{}
+	address    string
+	client     http.Client
+	storage    storage.Storage
+	logger     *zap.Logger
+	owner      string
+	workers    int
+	interval   time.Duration
+	lease      time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	jobs       chan *storage.OrderCheck
+	limiter    *rate.Limiter
+	breaker    *breaker
+	stats      *Stats
+	giveUp     int
+	pauseUntil atomic.Int64
+	wg         sync.WaitGroup
+	stop       chan struct{}
+	stopOnce   sync.Once
 }
 
-func NewAccrual(address string, storage *storage.PGStorage, logger *zap.Logger) (*Accrual, error) {
+func NewAccrual(config *Config, appStorage storage.Storage, logger *zap.Logger) (*Accrual, error) {
+	config.setDefaults()
+
+	owner, err := newOwnerID()
+	if err != nil {
+		return nil, err
+	}
+
 	tr := &http.Transport{
-		MaxIdleConns:    1,
-		IdleConnTimeout: 60 * time.Second,
+		MaxIdleConns:        config.Concurrency,
+		MaxIdleConnsPerHost: config.Concurrency,
+		IdleConnTimeout:     60 * time.Second,
 	}
 	client := http.Client{Transport: tr}
 
 	stop := make(chan struct{})
 
 	return &Accrual{
-		address: address,
-		client:  client,
-		storage: storage,
-		logger:  logger,
-		stop:    stop,
+		address:    config.Address,
+		client:     client,
+		storage:    appStorage,
+		logger:     logger,
+		owner:      owner,
+		workers:    config.Concurrency,
+		interval:   time.Duration(config.ClaimInterval) * time.Second,
+		lease:      time.Duration(config.LeaseTime) * time.Second,
+		minBackoff: time.Duration(config.MinBackoff) * time.Second,
+		maxBackoff: time.Duration(config.MaxBackoff) * time.Second,
+		jobs:       make(chan *storage.OrderCheck, config.Concurrency),
+		limiter:    rate.NewLimiter(perMinute(config.RateLimit), 1),
+		breaker:    newBreaker(config.BreakerThreshold, time.Duration(config.BreakerTimeout)*time.Second),
+		stats:      newStats(),
+		giveUp:     config.GiveUpAttempts,
+		stop:       stop,
 	}, nil
 }
 
 func (a *Accrual) Start(ctx context.Context) error {
-	accrualTicker := time.NewTicker(accrualInterval * time.Millisecond)
-	defer accrualTicker.Stop()
+	for i := 0; i < a.workers; i++ {
+		a.wg.Add(1)
+		go a.work(ctx)
+	}
+
+	claimTicker := time.NewTicker(a.interval)
+	defer claimTicker.Stop()
 
 	for {
 		select {
 		case <-a.stop:
 			return nil
-		case <-accrualTicker.C:
-			a.checkOrders(ctx)
+		case <-claimTicker.C:
+			a.claimOrders(ctx)
 		}
 	}
 }
 
 func (a *Accrual) Stop(ctx context.Context) error {
-	close(a.stop)
+	a.stopOnce.Do(func() { close(a.stop) })
+	a.wg.Wait()
 	a.client.CloseIdleConnections()
 
 	return nil
 }
 
-func (a *Accrual) checkOrders(ctx context.Context) {
-	orders, err := a.storage.GetUnprocessedOrders(ctx)
+// Ping checks the accrual system answers, any HTTP status means it is reachable.
+func (a *Accrual) Ping(ctx context.Context) error {
+	if a.address == "" {
+		return errors.New("accrual system address is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.address, nil)
 	if err != nil {
-		a.logger.Sugar().Errorf("failed get unprocessed orders: %v", err)
+		return fmt.Errorf("failed init request to accrual system: %v", err)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("accrual system %s is unreachable: %v", a.address, err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// claimOrders fills the free places of the job queue with the due orders.
+func (a *Accrual) claimOrders(ctx context.Context) {
+	if a.paused() || a.breaker.open(time.Now()) {
 		return
 	}
 
-	for _, order := range orders {
-		if ctx.Err() != nil {
-			a.logger.Error("accrual contex error")
+	free := cap(a.jobs) - len(a.jobs)
+	if free <= 0 {
+		return
+	}
+
+	checks, err := a.storage.ClaimOrders(ctx, a.owner, free, a.lease)
+	if err != nil {
+		a.logger.Sugar().Errorf("failed claim unprocessed orders: %v", err)
+		return
+	}
+
+	for _, check := range checks {
+		a.jobs <- check
+	}
+}
+
+func (a *Accrual) work(ctx context.Context) {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case <-a.stop:
 			return
+		case check := <-a.jobs:
+			a.processOrder(ctx, check)
 		}
+	}
+}
 
-		err := a.checkOrder(ctx, order)
-		if err == errTooManyRequests {
-			a.logger.Error("too many requests to accrual server")
-			time.Sleep(waitAfterToMany * time.Second)
-			return
+// Stats returns the counters of the order checks.
+func (a *Accrual) Stats() *Stats {
+	return a.stats
+}
+
+// processOrder checks the order and schedules its next check.
+// A changed status resets the backoff, otherwise the delay doubles up to the maximum.
+// The order unknown to the accrual system in giveUp answers in a row becomes INVALID.
+func (a *Accrual) processOrder(ctx context.Context, check *storage.OrderCheck) {
+	ctx, span := tracing.Tracer().Start(ctx, "accrual.processOrder", trace.WithAttributes(
+		orderNumberKey.String(check.Number),
+		attribute.Int("gophmarkt.order.check_attempts", check.Attempts),
+	))
+	defer span.End()
+
+	attempts := check.Attempts + 1
+	// any other answer of the accrual system breaks the row of the unknown order answers
+	notRegistered := 0
+
+	status, err := check.Status, a.throttle(ctx)
+	if err == nil {
+		status, err = a.checkOrder(ctx, check)
+		if errors.Is(err, errServerFailure) {
+			if a.breaker.failure(time.Now()) {
+				a.logger.Sugar().Warnf("circuit to accrual system is open for %v: %v", a.breaker.timeout, err)
+			}
+		} else {
+			a.breaker.success()
 		}
-		if err != nil {
-			a.logger.Sugar().Errorf("failed check order %s: %v", order.Number, err)
+	}
+
+	if errors.Is(err, errNotRegistered) {
+		notRegistered = check.NotRegistered + 1
+	}
+
+	if errors.Is(err, errNotRegistered) && notRegistered >= a.giveUp {
+		status, err = storage.OrderStatusInvalid, a.storage.UpdateOrder(ctx, &storage.Order{
+			Number:     check.Number,
+			Status:     storage.OrderStatusInvalid,
+			UploadedAt: time.Now(),
+		}, storage.EventSourcePoller)
+		if err == nil {
+			a.stats.add(OutcomeGaveUp)
+			a.logger.Sugar().Warnf("order %s is not registered after %d checks, marked invalid", check.Number, notRegistered)
 		}
+	} else {
+		a.stats.add(classify(err, status != check.Status))
+	}
+	span.SetAttributes(attribute.String("gophmarkt.order.status", string(status)))
 
-		time.Sleep(waitBetweenRequests * time.Millisecond)
+	var tooMany *tooManyRequestsError
+	switch {
+	case errors.Is(err, errPaused), errors.Is(err, errCircuitOpen):
+		attempts = check.Attempts
+		notRegistered = check.NotRegistered
+	case errors.As(err, &tooMany):
+		a.logger.Sugar().Warnf("accrual server rejected order %s: %v", check.Number, err)
+		a.pause(time.Now().Add(tooMany.retryAfter))
+		a.adaptLimit(tooMany.limit)
+		attempts = check.Attempts
+		notRegistered = check.NotRegistered
+	case errors.Is(err, errNotRegistered):
+		a.logger.Sugar().Debugf("order %s: %v", check.Number, err)
+	case err != nil:
+		a.logger.Sugar().Errorf("failed check order %s: %v", check.Number, err)
+	case status != check.Status:
+		attempts = 0
 	}
+
+	next := time.Now().Add(a.backoff(attempts))
+	if a.paused() {
+		next = time.Unix(0, a.pauseUntil.Load())
+	}
+
+	err = a.storage.ScheduleOrderCheck(ctx, check.Number, a.owner, attempts, notRegistered, next)
+	if err != nil {
+		a.logger.Sugar().Warnf("failed schedule check of order %s: %v", check.Number, err)
+	}
+}
+
+func (a *Accrual) backoff(attempts int) time.Duration {
+	delay := a.minBackoff
+	for i := 0; i < attempts && delay < a.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > a.maxBackoff {
+		delay = a.maxBackoff
+	}
+
+	return delay
 }
 
-func (a *Accrual) checkOrder(ctx context.Context, order *storage.Order) error {
+func newOwnerID() (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+
+	buf := make([]byte, ownerIDLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed generate accrual owner id: %v", err)
+	}
+
+	return host + "-" + hex.EncodeToString(buf), nil
+}
+
+// checkOrder requests the order from the accrual system and saves its new state.
+// It returns the status of the order after the check.
+// The request carries the W3C trace context of the check.
+func (a *Accrual) checkOrder(ctx context.Context, order *storage.OrderCheck) (status storage.OrderStatus, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "accrual.checkOrder", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(http.MethodGet),
+		orderNumberKey.String(order.Number),
+	))
+	defer func() {
+		// the order unknown yet is the expected answer
+		if errors.Is(err, errNotRegistered) {
+			tracing.End(span, nil)
+			return
+		}
+		tracing.End(span, err)
+	}()
+
 	var body string
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodGet,
 		fmt.Sprintf("%s%s", a.address, fmt.Sprintf(accrualHandler, order.Number)),
 		strings.NewReader(body),
 	)
 	if err != nil {
-		return fmt.Errorf("failed init request for order %s: %v", order.Number, err)
+		return order.Status, fmt.Errorf("failed init request for order %s: %v", order.Number, err)
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := a.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed request accrual data from %s for order %s: %v", a.address, order.Number, err)
+		a.stats.addResponse(ResponseFailed)
+		return order.Status, &serverError{err: fmt.Errorf("failed request accrual data from %s for order %s: %v", a.address, order.Number, err)}
 	}
 	defer resp.Body.Close()
+	a.stats.addResponse(responseClass(resp.StatusCode))
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return errTooManyRequests
+	if resp.StatusCode == http.StatusNoContent {
+		return order.Status, errNotRegistered
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed read accrual data for order %s: %v", order.Number, err)
+		return order.Status, fmt.Errorf("failed read accrual data for order %s: %v", order.Number, err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return order.Status, newTooManyRequestsError(resp.Header, bodyBytes, time.Now())
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return order.Status, &serverError{statusCode: resp.StatusCode}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return order.Status, fmt.Errorf("unexpected status %d of accrual data for order %s", resp.StatusCode, order.Number)
 	}
 
 	var accrualOrder AccrualOrder
 	err = json.Unmarshal(bodyBytes, &accrualOrder)
 	if err != nil {
-		return fmt.Errorf("failed unmarshal accrual data for order %s: %v", order.Number, err)
+		return order.Status, fmt.Errorf("failed unmarshal accrual data for order %s: %v", order.Number, err)
 	}
 
 	if accrualOrder.Order != order.Number {
-		return fmt.Errorf("orders numbers is not equal send %s receive %s ", order.Number, accrualOrder.Order)
+		return order.Status, fmt.Errorf("orders numbers is not equal send %s receive %s ", order.Number, accrualOrder.Order)
+	}
+
+	return a.applyUpdate(ctx, order.Status, &accrualOrder, storage.EventSourcePoller)
+}
+
+// ApplyUpdate saves the state of the order pushed by the accrual system.
+// The update that does not change the order is accepted as is.
+func (a *Accrual) ApplyUpdate(ctx context.Context, update *AccrualOrder) error {
+	_, err := a.applyUpdate(ctx, "", update, storage.EventSourceCallback)
+
+	return err
+}
+
+// applyUpdate maps the state reported by the accrual system to the order status and saves it.
+// It returns the status of the order after the update.
+func (a *Accrual) applyUpdate(
+	ctx context.Context,
+	current storage.OrderStatus,
+	update *AccrualOrder,
+	source storage.OrderEventSource,
+) (storage.OrderStatus, error) {
+	if update.Status == orderRegistered {
+		return current, nil
 	}
 
-	if accrualOrder.Status == orderRegistered {
-		return nil
+	status, ok := accrualToStorage[update.Status]
+	if !ok {
+		return current, fmt.Errorf("%w: unknown status %s of order %s", ErrInvalidUpdate, update.Status, update.Order)
 	}
 
-	if accrualToStorage[accrualOrder.Status] != order.Status {
-		newOrder := &storage.Order{
-			Number:     accrualOrder.Order,
-			Status:     accrualToStorage[accrualOrder.Status],
-			Accrual:    accrualOrder.Accrual,
-			UploadedAt: time.Now(),
-		}
+	if update.Accrual < 0 {
+		return current, fmt.Errorf("%w: negative accrual %s of order %s", ErrInvalidUpdate, update.Accrual, update.Order)
+	}
 
-		err := a.storage.UpdateOrder(ctx, newOrder)
-		if err != nil {
-			return err
-		}
+	if status == current {
+		return current, nil
 	}
 
-	return nil
+	err := a.storage.UpdateOrder(ctx, &storage.Order{
+		Number:     update.Order,
+		Status:     status,
+		Accrual:    update.Accrual,
+		UploadedAt: time.Now(),
+	}, source)
+	if err != nil {
+		return current, err
+	}
+
+	return status, nil
 }
@@ -0,0 +1,92 @@
+package gophmarktaccrual
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+// scriptedAnswers answers the statuses in turn, the last one is repeated.
+// The 429 answers ask to retry at once.
+func scriptedAnswers(statuses ...int) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		mu.Unlock()
+
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}
+}
+
+func TestProcessOrderGiveUp(t *testing.T) {
+	const order = "12345678903"
+
+	tests := []struct {
+		name        string
+		answers     []int
+		wantInvalid bool
+	}{
+		{
+			name:        "not registered in a row",
+			answers:     []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent},
+			wantInvalid: true,
+		},
+		{
+			name:    "not registered less than give up attempts",
+			answers: []int{http.StatusNoContent, http.StatusNoContent},
+		},
+		{
+			name:    "server failures before not registered",
+			answers: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusNoContent},
+		},
+		{
+			name:    "server failure breaks the row",
+			answers: []int{http.StatusNoContent, http.StatusNoContent, http.StatusBadGateway, http.StatusNoContent},
+		},
+		{
+			name:        "too many requests inside the row",
+			answers:     []int{http.StatusNoContent, http.StatusTooManyRequests, http.StatusNoContent, http.StatusNoContent},
+			wantInvalid: true,
+		},
+		{
+			name:        "row after server failure",
+			answers:     []int{http.StatusNoContent, http.StatusBadGateway, http.StatusNoContent, http.StatusNoContent, http.StatusNoContent},
+			wantInvalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newAccrualStub(t, scriptedAnswers(tt.answers...))
+			a, appStorage := newTestAccrual(t, stub.server.URL, &Config{GiveUpAttempts: 3, BreakerThreshold: 100}, order)
+			// every check is due at once
+			a.minBackoff, a.maxBackoff = 0, 0
+
+			for range tt.answers {
+				checks := claim(t, a)
+				if len(checks) == 0 {
+					break
+				}
+				a.processOrder(context.Background(), checks[0])
+			}
+
+			got, err := appStorage.GetOrder(context.Background(), order, testLogin)
+			if err != nil {
+				t.Fatalf("failed get order: %v", err)
+			}
+			if invalid := got.Status == storage.OrderStatusInvalid; invalid != tt.wantInvalid {
+				t.Errorf("order status = %s, want invalid %v", got.Status, tt.wantInvalid)
+			}
+		})
+	}
+}
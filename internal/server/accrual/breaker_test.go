@@ -0,0 +1,50 @@
+package gophmarktaccrual
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(2, time.Minute)
+
+	if b.failure(now) {
+		t.Fatal("circuit is open after 1 failure, threshold is 2")
+	}
+	if !b.allow(now) {
+		t.Fatal("request is rejected below the threshold")
+	}
+	if !b.failure(now) {
+		t.Fatal("circuit is closed after 2 failures in a row")
+	}
+	if b.allow(now.Add(time.Second)) || !b.open(now.Add(time.Second)) {
+		t.Fatal("open circuit lets the request through")
+	}
+
+	// one probe after the timeout
+	after := now.Add(time.Minute)
+	if !b.allow(after) {
+		t.Fatal("probe is rejected after the timeout")
+	}
+	if b.allow(after) {
+		t.Error("second request is let through during the probe")
+	}
+
+	// the failed probe reopens the circuit
+	if !b.failure(after) {
+		t.Error("failed probe does not reopen the circuit")
+	}
+	if b.allow(after.Add(time.Second)) {
+		t.Error("reopened circuit lets the request through")
+	}
+
+	// the successful probe closes it
+	if !b.allow(after.Add(time.Minute)) {
+		t.Fatal("probe is rejected after the second timeout")
+	}
+	b.success()
+	if !b.allow(after.Add(time.Minute)) || b.open(after.Add(time.Minute)) {
+		t.Error("circuit stays open after the successful probe")
+	}
+}
@@ -0,0 +1,62 @@
+package gophmarktaccrual
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// headers of the pushed accrual update
+	SignatureHeader = "X-Accrual-Signature"
+	TimestampHeader = "X-Accrual-Timestamp"
+
+	signaturePrefix = "sha256="
+	// allowed difference between the timestamp of the update and the local clock
+	signatureSkew = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid accrual update signature")
+
+// Sign returns the signature of the update body sent at the unix timestamp.
+// The signature is HMAC-SHA256 of "<timestamp>.<body>" in hex with the sha256= prefix.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature and rejects the updates signed too far from now.
+func VerifySignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("%w: secret is not set", ErrInvalidSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrInvalidSignature, timestamp)
+	}
+
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > signatureSkew || skew < -signatureSkew {
+		return fmt.Errorf("%w: timestamp %s is out of the allowed window", ErrInvalidSignature, timestamp)
+	}
+
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return fmt.Errorf("%w: unknown signature format", ErrInvalidSignature)
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
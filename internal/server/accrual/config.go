@@ -0,0 +1,85 @@
+package gophmarktaccrual
+
+const (
+	defaultConcurrency = 4
+	defaultClaimTime   = 1
+	defaultLeaseTime   = 60
+	defaultMinBackoff  = 1
+	defaultMaxBackoff  = 300
+	defaultGiveUp      = 20
+	defaultBreakerRow  = 5
+	defaultBreakerTime = 30
+	defaultFallback    = 60
+)
+
+type Config struct {
+	// address of the accrual system
+	Address string `yaml:"address"`
+	// number of orders checked in parallel
+	Concurrency int `yaml:"concurrency"`
+	// interval in seconds between the claims of the due orders
+	ClaimInterval int32 `yaml:"claim_interval"`
+	// time in seconds the claimed order stays with this instance
+	LeaseTime int32 `yaml:"lease_time"`
+	// first and maximal delay in seconds between the checks of an order without progress
+	MinBackoff int32 `yaml:"min_backoff"`
+	MaxBackoff int32 `yaml:"max_backoff"`
+	// requests per minute to the accrual system, 0 means no limit until the system announces one
+	RateLimit int `yaml:"rate_limit"`
+	// answers in a row the order is unknown to the accrual system before it becomes INVALID
+	GiveUpAttempts int `yaml:"give_up_attempts"`
+	// server failures in a row that open the circuit and time in seconds it stays open
+	BreakerThreshold int   `yaml:"breaker_threshold"`
+	BreakerTimeout   int32 `yaml:"breaker_timeout"`
+	// secret of the signed updates pushed by the accrual system, empty disables the callback
+	CallbackSecret string `yaml:"callback_secret"`
+	// minimal delay in seconds between the polls of an order when the callback is enabled,
+	// min_backoff defaults to it and must not be less
+	FallbackDelay int32 `yaml:"fallback_delay"`
+}
+
+// setDefaults fills the settings left at zero, the given values are checked by the config validation.
+func (c *Config) setDefaults() {
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultConcurrency
+	}
+
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = defaultClaimTime
+	}
+
+	if c.LeaseTime <= 0 {
+		c.LeaseTime = defaultLeaseTime
+	}
+
+	if c.GiveUpAttempts <= 0 {
+		c.GiveUpAttempts = defaultGiveUp
+	}
+
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = defaultBreakerRow
+	}
+
+	if c.BreakerTimeout <= 0 {
+		c.BreakerTimeout = defaultBreakerTime
+	}
+
+	if c.FallbackDelay <= 0 {
+		c.FallbackDelay = defaultFallback
+	}
+
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = defaultMinBackoff
+		// the poller only reconciles the orders without callbacks
+		if c.CallbackSecret != "" {
+			c.MinBackoff = c.FallbackDelay
+		}
+	}
+
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+		if c.MaxBackoff < c.MinBackoff {
+			c.MaxBackoff = c.MinBackoff
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package gophmarktaccrual
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidUpdate is the order state that can not be applied to the order.
+	ErrInvalidUpdate = errors.New("invalid accrual update")
+
+	errNotRegistered = errors.New("order is not registered in accrual system")
+	errServerFailure = errors.New("accrual system failure")
+	errCircuitOpen   = errors.New("circuit to accrual system is open")
+)
+
+// serverError is a failure on the side of the accrual system: 5xx answer or no answer at all.
+type serverError struct {
+	statusCode int
+	err        error
+}
+
+func (e *serverError) Error() string {
+	if e.statusCode == 0 {
+		return fmt.Sprintf("%v: %v", errServerFailure, e.err)
+	}
+
+	return fmt.Sprintf("%v: status %d", errServerFailure, e.statusCode)
+}
+
+func (e *serverError) Is(target error) bool {
+	return target == errServerFailure
+}
+
+func (e *serverError) Unwrap() error {
+	return e.err
+}
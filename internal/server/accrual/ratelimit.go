@@ -0,0 +1,146 @@
+package gophmarktaccrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const defaultRetryAfter = 60 * time.Second
+
+var (
+	errTooManyRequests = errors.New("too many requests")
+	errPaused          = errors.New("requests to accrual system are paused")
+	rateLimitRe        = regexp.MustCompile(`No more than (\d+) requests per minute`)
+)
+
+// tooManyRequestsError is the 429 answer of the accrual system.
+type tooManyRequestsError struct {
+	retryAfter time.Duration
+	// requests per minute announced in the body, 0 when absent
+	limit int
+}
+
+func (e *tooManyRequestsError) Error() string {
+	return fmt.Sprintf("%v, retry after %v, limit %d requests per minute", errTooManyRequests, e.retryAfter, e.limit)
+}
+
+func (e *tooManyRequestsError) Is(target error) bool {
+	return target == errTooManyRequests
+}
+
+func newTooManyRequestsError(header http.Header, body []byte, now time.Time) *tooManyRequestsError {
+	return &tooManyRequestsError{
+		retryAfter: parseRetryAfter(header.Get("Retry-After"), now),
+		limit:      parseRateLimit(body),
+	}
+}
+
+// parseRetryAfter accepts both forms of the header: delay in seconds and HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return defaultRetryAfter
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+
+		return 0
+	}
+
+	return defaultRetryAfter
+}
+
+func parseRateLimit(body []byte) int {
+	match := rateLimitRe.FindSubmatch(body)
+	if match == nil {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(string(match[1]))
+	if err != nil || limit <= 0 {
+		return 0
+	}
+
+	return limit
+}
+
+func perMinute(limit int) rate.Limit {
+	if limit <= 0 {
+		return rate.Inf
+	}
+
+	return rate.Limit(float64(limit) / 60)
+}
+
+// pause stops the requests of all workers until the given time.
+func (a *Accrual) pause(until time.Time) {
+	for {
+		current := a.pauseUntil.Load()
+		if until.UnixNano() <= current || a.pauseUntil.CompareAndSwap(current, until.UnixNano()) {
+			return
+		}
+	}
+}
+
+// adaptLimit follows the limit announced by the accrual system,
+// without an announced limit the current rate is halved.
+func (a *Accrual) adaptLimit(limit int) {
+	current := a.limiter.Limit()
+	next := perMinute(limit)
+	if limit <= 0 {
+		if current == rate.Inf {
+			return
+		}
+		next = current / 2
+	}
+
+	if next == current {
+		return
+	}
+
+	a.limiter.SetLimit(next)
+	a.logger.Sugar().Infof("accrual rate limit set to %.2f requests per minute", float64(next)*60)
+}
+
+// throttle waits for the limiter to allow the next request.
+// During the pause or with the open circuit the order is not held by the worker and an error is returned at once.
+func (a *Accrual) throttle(ctx context.Context) error {
+	if a.paused() {
+		return errPaused
+	}
+
+	if !a.breaker.allow(time.Now()) {
+		return errCircuitOpen
+	}
+
+	if err := a.limiter.Wait(ctx); err != nil {
+		// the request is not sent, the probe passes to the next one
+		a.breaker.release()
+		return err
+	}
+
+	return nil
+}
+
+func (a *Accrual) paused() bool {
+	return time.Now().UnixNano() < a.pauseUntil.Load()
+}
@@ -0,0 +1,310 @@
+package gophmarktaccrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const testLogin = "user"
+
+// accrualStub is a local accrual system answering every request with the handler.
+type accrualStub struct {
+	server   *httptest.Server
+	requests atomic.Int32
+}
+
+func newAccrualStub(t *testing.T, handler http.HandlerFunc) *accrualStub {
+	t.Helper()
+
+	stub := &accrualStub{}
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(stub.server.Close)
+
+	return stub
+}
+
+// tooManyRequests answers 429 with the Retry-After header and the limit in the body.
+func tooManyRequests(retryAfter string, limit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", retryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+		if limit > 0 {
+			fmt.Fprintf(w, "No more than %d requests per minute allowed", limit)
+		}
+	}
+}
+
+// newTestAccrual returns the accrual service of the stub with the orders uploaded to the memory storage.
+func newTestAccrual(t *testing.T, address string, config *Config, orders ...string) (*Accrual, storage.Storage) {
+	t.Helper()
+
+	hasher, err := storage.NewPasswordHasher(storage.HashBcrypt)
+	if err != nil {
+		t.Fatalf("failed init password hasher: %v", err)
+	}
+	appStorage := storage.NewMemStorage(hasher)
+
+	for _, order := range orders {
+		if _, err := appStorage.AddOrder(context.Background(), order, testLogin); err != nil {
+			t.Fatalf("failed add order %s: %v", order, err)
+		}
+	}
+
+	if config == nil {
+		config = &Config{}
+	}
+	config.Address = address
+
+	a, err := NewAccrual(config, appStorage, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed init accrual: %v", err)
+	}
+
+	return a, appStorage
+}
+
+// claim leases all the due orders to the accrual service.
+func claim(t *testing.T, a *Accrual) []*storage.OrderCheck {
+	t.Helper()
+
+	checks, err := a.storage.ClaimOrders(context.Background(), a.owner, 100, a.lease)
+	if err != nil {
+		t.Fatalf("failed claim orders: %v", err)
+	}
+
+	return checks
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "seconds", value: "7", want: 7 * time.Second},
+		{name: "seconds with spaces", value: " 30 ", want: 30 * time.Second},
+		{name: "zero seconds", value: "0", want: 0},
+		{name: "http date", value: now.Add(2 * time.Minute).Format(http.TimeFormat), want: 2 * time.Minute},
+		{name: "http date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "empty", value: "", want: defaultRetryAfter},
+		{name: "negative seconds", value: "-5", want: defaultRetryAfter},
+		{name: "garbage", value: "soon", want: defaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "limit", body: "No more than 10 requests per minute allowed", want: 10},
+		{name: "limit inside text", body: "Error: No more than 120 requests per minute. Try later", want: 120},
+		{name: "zero limit", body: "No more than 0 requests per minute allowed", want: 0},
+		{name: "other text", body: "Too Many Requests", want: 0},
+		{name: "empty", body: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRateLimit([]byte(tt.body)); got != tt.want {
+				t.Errorf("parseRateLimit(%q) = %d, want %d", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOrderRetryAfterSeconds(t *testing.T) {
+	stub := newAccrualStub(t, tooManyRequests("7", 30))
+	a, _ := newTestAccrual(t, stub.server.URL, nil, "12345678903")
+
+	_, err := a.checkOrder(context.Background(), claim(t, a)[0])
+
+	var tooMany *tooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("checkOrder error = %v, want too many requests", err)
+	}
+	if tooMany.retryAfter != 7*time.Second {
+		t.Errorf("retry after = %v, want 7s", tooMany.retryAfter)
+	}
+	if tooMany.limit != 30 {
+		t.Errorf("limit = %d, want 30", tooMany.limit)
+	}
+}
+
+func TestCheckOrderRetryAfterHTTPDate(t *testing.T) {
+	retryAt := time.Now().Add(90 * time.Second)
+	stub := newAccrualStub(t, tooManyRequests(retryAt.UTC().Format(http.TimeFormat), 0))
+	a, _ := newTestAccrual(t, stub.server.URL, nil, "12345678903")
+
+	_, err := a.checkOrder(context.Background(), claim(t, a)[0])
+
+	var tooMany *tooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("checkOrder error = %v, want too many requests", err)
+	}
+	// the date has a precision of a second
+	if tooMany.retryAfter <= 85*time.Second || tooMany.retryAfter > 90*time.Second {
+		t.Errorf("retry after = %v, want about 90s", tooMany.retryAfter)
+	}
+	if tooMany.limit != 0 {
+		t.Errorf("limit = %d, want 0 without the limit in the body", tooMany.limit)
+	}
+}
+
+func TestTooManyRequestsPausesAllWorkers(t *testing.T) {
+	stub := newAccrualStub(t, tooManyRequests("1", 0))
+	a, appStorage := newTestAccrual(t, stub.server.URL, &Config{Concurrency: 4},
+		"12345678903", "79927398713", "2377225624", "4561261212345467")
+
+	checks := claim(t, a)
+	if len(checks) != 4 {
+		t.Fatalf("claimed %d orders, want 4", len(checks))
+	}
+
+	start := time.Now()
+	a.processOrder(context.Background(), checks[0])
+	if stub.requests.Load() != 1 {
+		t.Fatalf("accrual system got %d requests, want 1", stub.requests.Load())
+	}
+	if !a.paused() {
+		t.Fatal("accrual service is not paused after 429")
+	}
+
+	// the other workers do not call the accrual system during the pause
+	var wg sync.WaitGroup
+	for _, check := range checks[1:] {
+		wg.Add(1)
+		go func(check *storage.OrderCheck) {
+			defer wg.Done()
+			a.processOrder(context.Background(), check)
+		}(check)
+	}
+	wg.Wait()
+
+	if stub.requests.Load() != 1 {
+		t.Errorf("accrual system got %d requests during the pause, want 1", stub.requests.Load())
+	}
+	if err := a.throttle(context.Background()); !errors.Is(err, errPaused) {
+		t.Errorf("throttle during the pause = %v, want %v", err, errPaused)
+	}
+
+	// all the orders wait for the end of the pause
+	a.claimOrders(context.Background())
+	if len(a.jobs) != 0 {
+		t.Errorf("claimed %d orders during the pause, want none", len(a.jobs))
+	}
+
+	until := time.Unix(0, a.pauseUntil.Load())
+	if until.Before(start.Add(time.Second)) {
+		t.Errorf("pause ends at %v, want not before %v", until, start.Add(time.Second))
+	}
+
+	time.Sleep(time.Until(until))
+	if err := a.throttle(context.Background()); err != nil {
+		t.Errorf("throttle after the pause = %v, want nil", err)
+	}
+
+	due, err := appStorage.ClaimOrders(context.Background(), a.owner, 100, a.lease)
+	if err != nil {
+		t.Fatalf("failed claim orders: %v", err)
+	}
+	if len(due) != 4 {
+		t.Errorf("%d orders are due after the pause, want 4", len(due))
+	}
+	for _, check := range due {
+		if check.Attempts != 0 {
+			t.Errorf("order %s has %d attempts, the rejected checks must not count", check.Number, check.Attempts)
+		}
+	}
+}
+
+func TestTooManyRequestsAdaptsLimit(t *testing.T) {
+	stub := newAccrualStub(t, tooManyRequests("0", 30))
+	a, _ := newTestAccrual(t, stub.server.URL, nil, "12345678903")
+
+	if a.limiter.Limit() != rate.Inf {
+		t.Fatalf("initial limit = %v, want no limit", a.limiter.Limit())
+	}
+
+	a.processOrder(context.Background(), claim(t, a)[0])
+
+	if got, want := a.limiter.Limit(), rate.Limit(30.0/60); got != want {
+		t.Errorf("limit = %v requests per second, want %v", got, want)
+	}
+}
+
+func TestAdaptLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		current rate.Limit
+		limit   int
+		want    rate.Limit
+	}{
+		{name: "announced limit", current: rate.Inf, limit: 60, want: 1},
+		{name: "announced lower limit", current: 1, limit: 30, want: 0.5},
+		{name: "no limit announced halves the rate", current: 1, limit: 0, want: 0.5},
+		{name: "no limit announced keeps unlimited", current: rate.Inf, limit: 0, want: rate.Inf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Accrual{
+				limiter: rate.NewLimiter(tt.current, 1),
+				logger:  zap.NewNop(),
+			}
+
+			a.adaptLimit(tt.limit)
+
+			if got := a.limiter.Limit(); got != tt.want {
+				t.Errorf("limit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottleReleasesProbe(t *testing.T) {
+	a := &Accrual{
+		breaker: newBreaker(1, 0),
+		limiter: rate.NewLimiter(rate.Every(time.Hour), 1),
+		logger:  zap.NewNop(),
+	}
+	// the circuit is open and the timeout has passed, the next request is the probe
+	a.breaker.failure(time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.throttle(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("throttle with the cancelled context = %v, want %v", err, context.Canceled)
+	}
+
+	a.limiter.SetLimit(rate.Inf)
+	if err := a.throttle(context.Background()); err != nil {
+		t.Errorf("throttle after the unsent probe = %v, want nil", err)
+	}
+}
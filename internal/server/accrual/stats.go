@@ -0,0 +1,145 @@
+package gophmarktaccrual
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+type Outcome string
+
+// outcomes of the order checks
+const (
+	OutcomeUpdated         Outcome = "updated"
+	OutcomeUnchanged       Outcome = "unchanged"
+	OutcomeNotRegistered   Outcome = "not_registered"
+	OutcomeGaveUp          Outcome = "gave_up"
+	OutcomeTooManyRequests Outcome = "too_many_requests"
+	OutcomeServerError     Outcome = "server_error"
+	OutcomeCircuitOpen     Outcome = "circuit_open"
+	OutcomePaused          Outcome = "paused"
+	OutcomeFailed          Outcome = "failed"
+)
+
+var outcomes = []Outcome{
+	OutcomeUpdated,
+	OutcomeUnchanged,
+	OutcomeNotRegistered,
+	OutcomeGaveUp,
+	OutcomeTooManyRequests,
+	OutcomeServerError,
+	OutcomeCircuitOpen,
+	OutcomePaused,
+	OutcomeFailed,
+}
+
+type ResponseClass string
+
+// classes of the responses of the accrual system
+const (
+	ResponseOK              ResponseClass = "200"
+	ResponseNoContent       ResponseClass = "204"
+	ResponseTooManyRequests ResponseClass = "429"
+	ResponseServerError     ResponseClass = "5xx"
+	ResponseOther           ResponseClass = "other"
+	// the request got no response
+	ResponseFailed ResponseClass = "failed"
+)
+
+var responseClasses = []ResponseClass{
+	ResponseOK,
+	ResponseNoContent,
+	ResponseTooManyRequests,
+	ResponseServerError,
+	ResponseOther,
+	ResponseFailed,
+}
+
+// Stats counts the order checks by outcome and the polls of the accrual system by response class.
+type Stats struct {
+	counters  map[Outcome]*atomic.Int64
+	responses map[ResponseClass]*atomic.Int64
+}
+
+func newStats() *Stats {
+	counters := make(map[Outcome]*atomic.Int64, len(outcomes))
+	for _, outcome := range outcomes {
+		counters[outcome] = &atomic.Int64{}
+	}
+
+	responses := make(map[ResponseClass]*atomic.Int64, len(responseClasses))
+	for _, class := range responseClasses {
+		responses[class] = &atomic.Int64{}
+	}
+
+	return &Stats{
+		counters:  counters,
+		responses: responses,
+	}
+}
+
+func (s *Stats) add(outcome Outcome) {
+	s.counters[outcome].Add(1)
+}
+
+// Snapshot returns the current value of every counter.
+func (s *Stats) Snapshot() map[Outcome]int64 {
+	snapshot := make(map[Outcome]int64, len(s.counters))
+	for outcome, counter := range s.counters {
+		snapshot[outcome] = counter.Load()
+	}
+
+	return snapshot
+}
+
+func (s *Stats) addResponse(class ResponseClass) {
+	s.responses[class].Add(1)
+}
+
+// Responses returns the current number of the polls by response class.
+func (s *Stats) Responses() map[ResponseClass]int64 {
+	snapshot := make(map[ResponseClass]int64, len(s.responses))
+	for class, counter := range s.responses {
+		snapshot[class] = counter.Load()
+	}
+
+	return snapshot
+}
+
+// responseClass maps the status code of the accrual system to its class.
+func responseClass(statusCode int) ResponseClass {
+	switch {
+	case statusCode == http.StatusOK:
+		return ResponseOK
+	case statusCode == http.StatusNoContent:
+		return ResponseNoContent
+	case statusCode == http.StatusTooManyRequests:
+		return ResponseTooManyRequests
+	case statusCode >= http.StatusInternalServerError:
+		return ResponseServerError
+	}
+
+	return ResponseOther
+}
+
+// classify maps the result of the order check to its outcome.
+func classify(err error, changed bool) Outcome {
+	switch {
+	case err == nil && changed:
+		return OutcomeUpdated
+	case err == nil:
+		return OutcomeUnchanged
+	case errors.Is(err, errNotRegistered):
+		return OutcomeNotRegistered
+	case errors.Is(err, errTooManyRequests):
+		return OutcomeTooManyRequests
+	case errors.Is(err, errServerFailure):
+		return OutcomeServerError
+	case errors.Is(err, errCircuitOpen):
+		return OutcomeCircuitOpen
+	case errors.Is(err, errPaused):
+		return OutcomePaused
+	}
+
+	return OutcomeFailed
+}
@@ -5,14 +5,20 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
 
 	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+	auth "github.com/zvfkjytytw/gophmarkt/internal/server/auth"
+	gophmarktconfig "github.com/zvfkjytytw/gophmarkt/internal/server/config"
 	server "github.com/zvfkjytytw/gophmarkt/internal/server/http"
+	ledger "github.com/zvfkjytytw/gophmarkt/internal/server/ledger"
+	metrics "github.com/zvfkjytytw/gophmarkt/internal/server/metrics"
 	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+	tracing "github.com/zvfkjytytw/gophmarkt/internal/server/tracing"
 )
 
 type Service interface {
@@ -20,112 +26,140 @@ type Service interface {
 	Stop(context.Context) error
 }
 
-type AppConfig struct {
-	HTTPConfig    *server.Config  `yaml:"http_config" json:"http_config"`
-	StorageConfig *storage.Config `yaml:"storage_config" json:"storage_config"`
-	MigrationDir  string          `yaml:"migration_dir" json:"migration_dir"`
+// drainer stops taking the new work before the services are stopped.
+type drainer interface {
+	Drain()
 }
 
 type App struct {
-	services []Service
-	logger   *zap.Logger
+	services   []Service
+	logger     *zap.Logger
+	drainDelay time.Duration
+	stopOnce   sync.Once
+	// closed after all the services are stopped
+	storage storage.Storage
 }
 
-func NewApp(
-	runAddress,
-	databaseURI,
-	accrualSystem string,
-) (*App, error) {
-	logger, err := InitLogger()
+func NewApp(config *gophmarktconfig.AppConfig) (*App, error) {
+	logger, err := InitLogger(config.LogConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed init logger: %v", err)
 	}
 
 	services := make([]Service, 0, 1)
+	appMetrics := metrics.New(logger)
 
-	pgStorage, err := storage.NewPGStorage(databaseURI)
+	tracer, err := tracing.NewProvider(context.Background(), config.TracingConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed init storage: %v", err)
+		return nil, fmt.Errorf("failed init tracing: %v", err)
 	}
 
-	if err := pgStorage.ApplyMigrations(); err != nil {
-		logger.Sugar().Errorf("failed init DB: %v", err)
-		// return nil, err
-	}
+	var appStorage storage.Storage
+	var pgStorage *storage.PGStorage
+	// database system in the spans
+	var dbSystem string
+	switch config.StorageType {
+	case storage.TypeMemory:
+		dbSystem = "memory"
+		hasher, err := storage.NewPasswordHasher(config.StorageConfig.PasswordHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed init password hasher: %v", err)
+		}
 
-	httpServer, err := server.NewHTTPServer(runAddress, logger, pgStorage)
-	if err != nil {
-		logger.Sugar().Errorf("failed init HTTP server: %v", err)
-		return nil, err
-	}
-	services = append(services, httpServer)
+		appStorage = storage.NewMemStorage(hasher)
+	case storage.TypePostgres:
+		dbSystem = "postgresql"
+		pgDSN, err := storage.GetDSNFromConfig(config.StorageConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed format dsn: %v", err)
+		}
 
-	accrualService, err := accrual.NewAccrual(accrualSystem, pgStorage, logger)
-	if err != nil {
-		logger.Sugar().Errorf("failed init accrual service: %v", err)
-		return nil, err
-	}
-	services = append(services, accrualService)
+		pgStorage, err = storage.NewPGStorageFromConfig(config.StorageConfig, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed init storage: %v", err)
+		}
 
-	return &App{
-		services: services,
-		logger:   logger,
-	}, nil
-}
+		if err := storage.MigrateUp(pgDSN); err != nil {
+			logger.Sugar().Errorf("failed init DB: %v", err)
+			return nil, err
+		}
 
-func NewAppFromConfig(config *AppConfig) (*App, error) {
-	logger, err := InitLogger()
-	if err != nil {
-		return nil, fmt.Errorf("failed init logger: %v", err)
+		if err := appMetrics.RegisterDB(pgStorage.DB()); err != nil {
+			return nil, fmt.Errorf("failed register DB metrics: %v", err)
+		}
+		appStorage = pgStorage
+	default:
+		return nil, fmt.Errorf("unknown storage type %s", config.StorageType)
 	}
 
-	services := make([]Service, 0, 1)
-
-	pgDSN, err := storage.GetDSNFromConfig(config.StorageConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed format dsn: %v", err)
+	if err = appMetrics.RegisterStorage(appStorage); err != nil {
+		return nil, fmt.Errorf("failed register storage metrics: %v", err)
 	}
+	backend := appStorage
+	appStorage = appMetrics.Storage(tracing.Storage(appStorage, dbSystem))
 
-	pgStorage, err := storage.NewPGStorageFromConfig(config.StorageConfig)
+	tokens, err := newTokenManager(config.AuthConfig, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed init storage: %v", err)
-	}
-
-	if err := storage.ApplyMigrations(pgDSN, config.MigrationDir); err != nil {
-		logger.Sugar().Errorf("failed init DB: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("failed init token manager: %v", err)
 	}
 
 	httpServer, err := server.NewHTTPServerFromConfig(
 		config.HTTPConfig,
 		logger,
-		pgStorage,
+		appStorage,
+		tokens,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed init HTTP server: %v", err)
 	}
-
+	httpServer.EnableMetrics(appMetrics)
+	if pgStorage != nil {
+		httpServer.AddReadinessCheck("database", pgStorage.Ping)
+		httpServer.AddReadinessCheck("schema", pgStorage.CheckSchema)
+	}
 	services = append(services, httpServer)
 
+	accrualService, err := accrual.NewAccrual(config.AccrualConfig, appStorage, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed init accrual service: %v", err)
+	}
+	if err = appMetrics.RegisterAccrual(accrualService.Stats()); err != nil {
+		return nil, fmt.Errorf("failed register accrual metrics: %v", err)
+	}
+	services = append(services, accrualService)
+	// only the order checks need the accrual system, its outage is covered by the breaker
+	if config.AccrualConfig.Address != "" {
+		httpServer.AddOptionalCheck("accrual", accrualService.Ping)
+	}
+	if config.AccrualConfig.CallbackSecret != "" {
+		httpServer.EnableAccrualCallback(config.AccrualConfig.CallbackSecret, accrualService)
+	}
+	services = append(services, ledger.NewReconciler(appStorage, logger))
+	// the tracer is the last to stop to flush the spans of the other services
+	services = append(services, tracer)
+
 	return &App{
-		services: services,
-		logger:   logger,
+		services:   services,
+		storage:    backend,
+		logger:     logger,
+		drainDelay: time.Duration(config.HTTPConfig.DrainDelay) * time.Second,
 	}, nil
 }
 
-func NewAppFromFile(configFile string) (*App, error) {
-	config := &AppConfig{}
-	configData, err := ReadConfigFile(configFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed read config file: %v", err)
-	}
+// newTokenManager falls back to a random signing key when none is configured.
+func newTokenManager(config *auth.Config, logger *zap.Logger) (*auth.TokenManager, error) {
+	if len(config.SigningKeys) == 0 {
+		key, err := auth.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
 
-	err = yaml.Unmarshal(configData, config)
-	if err != nil {
-		return nil, fmt.Errorf("failed unmarshalling config file: %v", err)
+		logger.Warn("auth signing keys are not set, tokens will not survive a restart")
+		config.SigningKeys = []auth.Key{key}
+		config.ActiveKey = key.ID
 	}
 
-	return NewAppFromConfig(config)
+	return auth.NewTokenManager(config)
 }
 
 func (a *App) Run(ctx context.Context) {
@@ -137,27 +171,52 @@ func (a *App) Run(ctx context.Context) {
 		syscall.SIGTERM,
 		syscall.SIGQUIT,
 	)
+	failed := make(chan error, len(a.services))
 	for _, service := range a.services {
 		go func(service Service) {
 			err := service.Start(ctx)
 			if err != nil {
-				a.logger.Sugar().Errorf("service not started: %w", err)
-				a.StopAll(ctx)
-				return
+				a.logger.Sugar().Errorf("service not started: %v", err)
+				failed <- err
 			}
 		}(service)
 	}
 
-	stopSignal := <-sigChanel
-	a.logger.Sugar().Debugf("Stop by %v", stopSignal)
+	select {
+	case stopSignal := <-sigChanel:
+		a.logger.Sugar().Debugf("Stop by %v", stopSignal)
+	case <-failed:
+	}
 	a.StopAll(ctx)
 }
 
+// StopAll fails the readiness first, waits for the load balancers to drain the traffic and stops the services.
+// The storage is closed the last, the stopping services still use it. Only the first call stops the services.
 func (a *App) StopAll(ctx context.Context) {
-	for _, service := range a.services {
-		err := service.Stop(ctx)
-		if err != nil {
-			a.logger.Error("stop failed")
+	a.stopOnce.Do(func() {
+		for _, service := range a.services {
+			if d, ok := service.(drainer); ok {
+				d.Drain()
+			}
 		}
-	}
+
+		if a.drainDelay > 0 {
+			a.logger.Sugar().Infof("draining traffic for %v", a.drainDelay)
+			select {
+			case <-time.After(a.drainDelay):
+			case <-ctx.Done():
+			}
+		}
+
+		for _, service := range a.services {
+			err := service.Stop(ctx)
+			if err != nil {
+				a.logger.Sugar().Errorf("stop failed: %v", err)
+			}
+		}
+
+		if err := a.storage.Close(); err != nil {
+			a.logger.Sugar().Errorf("failed close storage: %v", err)
+		}
+	})
 }
@@ -1,36 +1,25 @@
 package gophmarktapp
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
-
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-)
 
-func ReadConfigFile(configFile string) ([]byte, error) {
-	filename, err := filepath.Abs(configFile)
-	if err != nil {
-		return nil, fmt.Errorf("file %s not found: %w", configFile, err)
-	}
+	gophmarktconfig "github.com/zvfkjytytw/gophmarkt/internal/server/config"
+)
 
-	yamlConfig, err := os.ReadFile(filename)
+func InitLogger(logConfig *gophmarktconfig.LogConfig) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(logConfig.Level)
 	if err != nil {
-		return nil, fmt.Errorf("fail read file %s: %w", configFile, err)
+		return nil, err
 	}
 
-	return yamlConfig, nil
-}
-
-func InitLogger() (*zap.Logger, error) {
 	config := zap.Config{
-		Level:            zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		Level:            zap.NewAtomicLevelAt(level),
 		Development:      true,
 		Encoding:         "json",
 		EncoderConfig:    zap.NewProductionEncoderConfig(),
-		OutputPaths:      []string{"stdout", "gophmarkt.log"},
-		ErrorOutputPaths: []string{"stderr", "gophmarkt.err"},
+		OutputPaths:      logConfig.OutputPaths,
+		ErrorOutputPaths: logConfig.ErrorOutputPaths,
 	}
 	logger, err := config.Build()
 	if err != nil {
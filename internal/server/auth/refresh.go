@@ -0,0 +1,43 @@
+package gophmarktauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const refreshSeparator = "."
+
+// The refresh token is "<session id>.<secret>".
+// Only the hash of the secret is stored, so a leaked table does not give valid tokens.
+
+// NewSessionID returns a random session identifier.
+func NewSessionID() (string, error) {
+	return newRandomID()
+}
+
+// NewRefreshToken returns a fresh refresh token of the session and the hash to store.
+func NewRefreshToken(sessionID string) (string, string, error) {
+	secret, err := newRandomID()
+	if err != nil {
+		return "", "", err
+	}
+
+	return sessionID + refreshSeparator + secret, hashSecret(secret), nil
+}
+
+// ParseRefreshToken returns the session id and the secret hash of the refresh token.
+func ParseRefreshToken(token string) (string, string, error) {
+	sessionID, secret, ok := strings.Cut(token, refreshSeparator)
+	if !ok || sessionID == "" || secret == "" {
+		return "", "", fmt.Errorf("%w: malformed refresh token", ErrInvalidToken)
+	}
+
+	return sessionID, hashSecret(secret), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
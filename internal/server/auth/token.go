@@ -0,0 +1,220 @@
+package gophmarktauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultTokenTTL   = 900
+	defaultRefreshTTL = 30 * 24 * 3600
+	defaultKeyID      = "default"
+	generatedKeyID    = "generated"
+	generatedKeyLen   = 32
+	randomIDLen       = 16
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+type Key struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+}
+
+type Config struct {
+	// keys used to verify tokens, the tokens are signed with ActiveKey
+	SigningKeys []Key  `yaml:"signing_keys"`
+	ActiveKey   string `yaml:"active_key"`
+	// lifetime of the access token in seconds
+	TokenTTL int32 `yaml:"token_ttl"`
+	// lifetime of the session without refresh in seconds
+	RefreshTTL int32 `yaml:"refresh_ttl"`
+}
+
+type Claims struct {
+	Login     string `json:"login"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager issues and verifies HMAC-SHA256 signed JWT.
+// Every token carries the id of its signing key in the kid header,
+// so old keys can stay in the verification set while a new key signs.
+type TokenManager struct {
+	keys       map[string][]byte
+	activeKey  string
+	ttl        time.Duration
+	refreshTTL time.Duration
+	parser     *jwt.Parser
+}
+
+func NewTokenManager(config *Config) (*TokenManager, error) {
+	keys := make(map[string][]byte, len(config.SigningKeys))
+	for _, key := range config.SigningKeys {
+		if key.ID == "" {
+			return nil, errors.New("signing key id is empty")
+		}
+
+		if key.Secret == "" {
+			return nil, fmt.Errorf("signing key %s has empty secret", key.ID)
+		}
+
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("signing key %s is duplicated", key.ID)
+		}
+
+		keys[key.ID] = []byte(key.Secret)
+	}
+
+	activeKey := config.ActiveKey
+	if activeKey == "" && len(config.SigningKeys) > 0 {
+		activeKey = config.SigningKeys[0].ID
+	}
+
+	if _, ok := keys[activeKey]; !ok {
+		return nil, fmt.Errorf("active signing key %s is not found", activeKey)
+	}
+
+	ttl := config.TokenTTL
+	if ttl <= 0 {
+		ttl = defaultTokenTTL
+	}
+
+	refreshTTL := config.RefreshTTL
+	if refreshTTL <= 0 {
+		refreshTTL = defaultRefreshTTL
+	}
+
+	return &TokenManager{
+		keys:       keys,
+		activeKey:  activeKey,
+		ttl:        time.Duration(ttl) * time.Second,
+		refreshTTL: time.Duration(refreshTTL) * time.Second,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+	}, nil
+}
+
+// ParseKeys reads keys in the form "id:secret[,id:secret...]".
+// A value without an id is treated as the secret of the default key.
+func ParseKeys(value string) ([]Key, error) {
+	keys := make([]Key, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(item, ":")
+		if !ok {
+			id, secret = defaultKeyID, item
+		}
+
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("signing key %q has invalid format", item)
+		}
+
+		keys = append(keys, Key{ID: id, Secret: secret})
+	}
+
+	return keys, nil
+}
+
+// GenerateKey creates a random signing key.
+// Tokens signed with it do not survive a restart and are not shared between instances.
+func GenerateKey() (Key, error) {
+	secret := make([]byte, generatedKeyLen)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, fmt.Errorf("failed generate signing key: %v", err)
+	}
+
+	return Key{ID: generatedKeyID, Secret: hex.EncodeToString(secret)}, nil
+}
+
+func (m *TokenManager) TTL() time.Duration {
+	return m.ttl
+}
+
+func (m *TokenManager) RefreshTTL() time.Duration {
+	return m.refreshTTL
+}
+
+// Issue returns a signed access token for the login session and its expiry time.
+func (m *TokenManager) Issue(login, sessionID string) (string, time.Time, error) {
+	tokenID, err := newRandomID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+	claims := &Claims{
+		Login:     login,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = m.activeKey
+
+	signed, err := token.SignedString(m.keys[m.activeKey])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed sign token for login %s: %v", login, err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+// Verify checks the signature and the lifetime of the token and returns its claims.
+func (m *TokenManager) Verify(signed string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := m.parser.ParseWithClaims(signed, claims, m.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Login == "" || claims.SessionID == "" || claims.ID == "" {
+		return nil, fmt.Errorf("%w: required claims are absent", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func (m *TokenManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+func newRandomID() (string, error) {
+	buf := make([]byte, randomIDLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed generate random id: %v", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
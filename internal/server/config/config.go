@@ -0,0 +1,180 @@
+// Package gophmarktconfig builds the configuration of the gophermart service.
+//
+// Every setting is taken from the first source that has it, in the order of precedence:
+//
+//	flags > environment variables > YAML file > defaults
+//
+// The YAML file is given by the -c flag or the CONFIG environment variable,
+// without it the service runs on the defaults, the environment and the flags.
+package gophmarktconfig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"go.uber.org/zap/zapcore"
+
+	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+	auth "github.com/zvfkjytytw/gophmarkt/internal/server/auth"
+	server "github.com/zvfkjytytw/gophmarkt/internal/server/http"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+	tracing "github.com/zvfkjytytw/gophmarkt/internal/server/tracing"
+)
+
+type AppConfig struct {
+	HTTPConfig    *server.Config  `yaml:"http_config" json:"http_config"`
+	StorageConfig *storage.Config `yaml:"storage_config" json:"storage_config"`
+	AuthConfig    *auth.Config    `yaml:"auth_config" json:"auth_config"`
+	AccrualConfig *accrual.Config `yaml:"accrual_config" json:"accrual_config"`
+	LogConfig     *LogConfig      `yaml:"log_config" json:"log_config"`
+	TracingConfig *tracing.Config `yaml:"tracing_config" json:"tracing_config"`
+	StorageType   string          `yaml:"storage_type" json:"storage_type"`
+}
+
+type LogConfig struct {
+	// debug, info, warn or error
+	Level            string   `yaml:"level" json:"level"`
+	OutputPaths      []string `yaml:"output_paths" json:"output_paths"`
+	ErrorOutputPaths []string `yaml:"error_output_paths" json:"error_output_paths"`
+}
+
+// Default returns the configuration used for the settings given by no source.
+func Default() *AppConfig {
+	return &AppConfig{
+		HTTPConfig: &server.Config{
+			Host:         "localhost",
+			Port:         8080,
+			ReadTimeout:  5,
+			WriteTimeout: 5,
+			IdleTimeout:  10,
+		},
+		StorageConfig: &storage.Config{
+			Host:         "localhost",
+			Port:         5432,
+			SSLMode:      "disable",
+			PasswordHash: storage.HashBcrypt,
+		},
+		AuthConfig: &auth.Config{
+			TokenTTL:   900,
+			RefreshTTL: 2592000,
+		},
+		AccrualConfig: &accrual.Config{
+			Concurrency:   4,
+			ClaimInterval: 1,
+			FallbackDelay: 60,
+		},
+		LogConfig: &LogConfig{
+			Level:            "info",
+			OutputPaths:      []string{"stdout", "gophmarkt.log"},
+			ErrorOutputPaths: []string{"stderr", "gophmarkt.err"},
+		},
+		TracingConfig: &tracing.Config{
+			Exporter:    tracing.ExporterNone,
+			File:        "gophmarkt.trace",
+			SampleRatio: 1,
+		},
+		StorageType: storage.TypePostgres,
+	}
+}
+
+// setAddress splits the run address into the host and the port of the HTTP server.
+func (c *AppConfig) setAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	value, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	c.HTTPConfig.Host = host
+	c.HTTPConfig.Port = int32(value)
+
+	return nil
+}
+
+// Validate checks the whole configuration, every error names the key of the offending setting.
+func (c *AppConfig) Validate() error {
+	errs := make([]error, 0)
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.HTTPConfig.Port > 0 && c.HTTPConfig.Port <= 65535, "http_config.port", "must be between 1 and 65535, got %d", c.HTTPConfig.Port)
+	check(c.HTTPConfig.ReadTimeout >= 0, "http_config.read_timeout", "must not be negative")
+	check(c.HTTPConfig.WriteTimeout >= 0, "http_config.write_timeout", "must not be negative")
+	check(c.HTTPConfig.IdleTimeout >= 0, "http_config.idle_timeout", "must not be negative")
+	check(c.HTTPConfig.DrainDelay >= 0, "http_config.drain_delay", "must not be negative")
+
+	switch c.StorageType {
+	case storage.TypeMemory:
+	case storage.TypePostgres:
+		check(c.StorageConfig.DatabaseURI != "" || c.StorageConfig.DBName != "",
+			"storage_config.database_uri", "must be set or storage_config.db_name must be given")
+	default:
+		check(false, "storage_type", "must be %s or %s, got %q", storage.TypePostgres, storage.TypeMemory, c.StorageType)
+	}
+
+	_, err := storage.NewPasswordHasher(c.StorageConfig.PasswordHash)
+	check(err == nil, "storage_config.password_hash", "%v", err)
+
+	check(c.AuthConfig.TokenTTL > 0, "auth_config.token_ttl", "must be positive")
+	check(c.AuthConfig.RefreshTTL > 0, "auth_config.refresh_ttl", "must be positive")
+	if c.AuthConfig.ActiveKey != "" {
+		found := false
+		for _, key := range c.AuthConfig.SigningKeys {
+			found = found || key.ID == c.AuthConfig.ActiveKey
+		}
+		check(found, "auth_config.active_key", "key %s is not among the signing keys", c.AuthConfig.ActiveKey)
+	}
+
+	check(c.AccrualConfig.Concurrency > 0, "accrual_config.concurrency", "must be positive")
+	check(c.AccrualConfig.ClaimInterval > 0, "accrual_config.claim_interval", "must be positive")
+	check(c.AccrualConfig.LeaseTime >= 0, "accrual_config.lease_time", "must not be negative")
+	check(c.AccrualConfig.MinBackoff >= 0, "accrual_config.min_backoff", "must not be negative")
+	check(c.AccrualConfig.MaxBackoff >= 0, "accrual_config.max_backoff", "must not be negative")
+	check(c.AccrualConfig.RateLimit >= 0, "accrual_config.rate_limit", "must not be negative")
+	check(c.AccrualConfig.GiveUpAttempts >= 0, "accrual_config.give_up_attempts", "must not be negative")
+	check(c.AccrualConfig.BreakerThreshold >= 0, "accrual_config.breaker_threshold", "must not be negative")
+	check(c.AccrualConfig.BreakerTimeout >= 0, "accrual_config.breaker_timeout", "must not be negative")
+	check(c.AccrualConfig.FallbackDelay >= 0, "accrual_config.fallback_delay", "must not be negative")
+
+	// zero backoffs are defaulted by the accrual service, with the callback the polls start from the fallback delay
+	minBackoff := c.AccrualConfig.MinBackoff
+	if c.AccrualConfig.CallbackSecret != "" {
+		check(minBackoff == 0 || minBackoff >= c.AccrualConfig.FallbackDelay, "accrual_config.min_backoff",
+			"must not be less than accrual_config.fallback_delay %d with the callback enabled, got %d", c.AccrualConfig.FallbackDelay, minBackoff)
+		if minBackoff == 0 {
+			minBackoff = c.AccrualConfig.FallbackDelay
+		}
+	}
+	check(c.AccrualConfig.MaxBackoff == 0 || c.AccrualConfig.MaxBackoff >= minBackoff, "accrual_config.max_backoff",
+		"must not be less than the minimal backoff %d, got %d", minBackoff, c.AccrualConfig.MaxBackoff)
+
+	_, err = zapcore.ParseLevel(c.LogConfig.Level)
+	check(err == nil, "log_config.level", "%v", err)
+	check(len(c.LogConfig.OutputPaths) > 0, "log_config.output_paths", "must not be empty")
+
+	switch c.TracingConfig.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	case tracing.ExporterFile:
+		check(c.TracingConfig.File != "", "tracing_config.file", "must be set for the %s exporter", tracing.ExporterFile)
+	default:
+		check(false, "tracing_config.exporter", "must be %s, %s, %s or %s, got %q",
+			tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterFile, tracing.ExporterOTLP, c.TracingConfig.Exporter)
+	}
+	check(c.TracingConfig.SampleRatio >= 0 && c.TracingConfig.SampleRatio <= 1,
+		"tracing_config.sample_ratio", "must be between 0 and 1, got %v", c.TracingConfig.SampleRatio)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package gophmarktconfig
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	auth "github.com/zvfkjytytw/gophmarkt/internal/server/auth"
+)
+
+const (
+	flagConfigFile = "c"
+	envConfigFile  = "CONFIG"
+)
+
+// option is a setting given by a flag and an environment variable.
+type option struct {
+	// key of the setting in the YAML file
+	key   string
+	flag  string
+	env   string
+	usage string
+	// the flag has no value
+	isBool bool
+	set    func(c *AppConfig, value string) error
+}
+
+var options = []option{
+	{
+		key: "http_config.host, http_config.port", flag: "a", env: "RUN_ADDRESS",
+		usage: "address and port of the service launch",
+		set:   func(c *AppConfig, value string) error { return c.setAddress(value) },
+	},
+	{
+		key: "http_config.validate_api", flag: "validate-api", env: "VALIDATE_API", isBool: true,
+		usage: "check the requests and responses against the OpenAPI document",
+		set:   setBool(func(c *AppConfig) *bool { return &c.HTTPConfig.ValidateAPI }),
+	},
+	{
+		key: "http_config.drain_delay", flag: "drain-delay", env: "DRAIN_DELAY",
+		usage: "seconds between the readiness failure and the shutdown",
+		set:   setInt32(func(c *AppConfig) *int32 { return &c.HTTPConfig.DrainDelay }),
+	},
+	{
+		key: "storage_type", flag: "s", env: "STORAGE_TYPE",
+		usage: "storage type: postgres or memory",
+		set:   setString(func(c *AppConfig) *string { return &c.StorageType }),
+	},
+	{
+		key: "storage_config.database_uri", flag: "d", env: "DATABASE_URI",
+		usage: "address of the database connection",
+		set:   setString(func(c *AppConfig) *string { return &c.StorageConfig.DatabaseURI }),
+	},
+	{
+		key: "storage_config.password_hash", flag: "hash", env: "PASSWORD_HASH",
+		usage: "password hash algorithm: bcrypt or argon2id",
+		set:   setString(func(c *AppConfig) *string { return &c.StorageConfig.PasswordHash }),
+	},
+	{
+		key: "auth_config.signing_keys", flag: "k", env: "AUTH_KEYS",
+		usage: "token signing keys id:secret[,id:secret...], the first one signs",
+		set: func(c *AppConfig, value string) error {
+			keys, err := auth.ParseKeys(value)
+			if err != nil {
+				return err
+			}
+
+			c.AuthConfig.SigningKeys = keys
+			c.AuthConfig.ActiveKey = ""
+			if len(keys) > 0 {
+				c.AuthConfig.ActiveKey = keys[0].ID
+			}
+
+			return nil
+		},
+	},
+	{
+		key: "auth_config.token_ttl", flag: "token-ttl", env: "AUTH_TOKEN_TTL",
+		usage: "lifetime of the access token in seconds",
+		set:   setInt32(func(c *AppConfig) *int32 { return &c.AuthConfig.TokenTTL }),
+	},
+	{
+		key: "auth_config.refresh_ttl", flag: "refresh-ttl", env: "AUTH_REFRESH_TTL",
+		usage: "lifetime of the session without refresh in seconds",
+		set:   setInt32(func(c *AppConfig) *int32 { return &c.AuthConfig.RefreshTTL }),
+	},
+	{
+		key: "accrual_config.address", flag: "r", env: "ACCRUAL_SYSTEM_ADDRESS",
+		usage: "address of the accrual calculation system",
+		set:   setString(func(c *AppConfig) *string { return &c.AccrualConfig.Address }),
+	},
+	{
+		key: "accrual_config.concurrency", flag: "w", env: "ACCRUAL_CONCURRENCY",
+		usage: "number of orders checked in the accrual system in parallel",
+		set: func(c *AppConfig, value string) error {
+			concurrency, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			c.AccrualConfig.Concurrency = concurrency
+
+			return nil
+		},
+	},
+	{
+		key: "accrual_config.claim_interval", flag: "i", env: "ACCRUAL_INTERVAL",
+		usage: "interval in seconds between the claims of the orders due for the accrual check",
+		set:   setInt32(func(c *AppConfig) *int32 { return &c.AccrualConfig.ClaimInterval }),
+	},
+	{
+		key: "accrual_config.callback_secret", flag: "cb", env: "ACCRUAL_CALLBACK_SECRET",
+		usage: "secret of the signed accrual callbacks, empty disables the callback",
+		set:   setString(func(c *AppConfig) *string { return &c.AccrualConfig.CallbackSecret }),
+	},
+	{
+		key: "log_config.level", flag: "l", env: "LOG_LEVEL",
+		usage: "log level: debug, info, warn or error",
+		set:   setString(func(c *AppConfig) *string { return &c.LogConfig.Level }),
+	},
+	{
+		key: "tracing_config.exporter", flag: "trace", env: "TRACE_EXPORTER",
+		usage: "exporter of the spans: none, stdout, file or otlp",
+		set:   setString(func(c *AppConfig) *string { return &c.TracingConfig.Exporter }),
+	},
+	{
+		key: "tracing_config.file", flag: "trace-file", env: "TRACE_FILE",
+		usage: "file of the file span exporter",
+		set:   setString(func(c *AppConfig) *string { return &c.TracingConfig.File }),
+	},
+	{
+		key: "tracing_config.endpoint", flag: "trace-endpoint", env: "TRACE_ENDPOINT",
+		usage: "URL of the OTLP/HTTP collector",
+		set:   setString(func(c *AppConfig) *string { return &c.TracingConfig.Endpoint }),
+	},
+	{
+		key: "tracing_config.sample_ratio", flag: "trace-ratio", env: "TRACE_SAMPLE_RATIO",
+		usage: "share of the new traces recorded, from 0 to 1",
+		set: func(c *AppConfig, value string) error {
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return err
+			}
+			c.TracingConfig.SampleRatio = ratio
+
+			return nil
+		},
+	},
+}
+
+// Load builds the configuration from the defaults, the YAML file, the environment and the command line arguments.
+// It also returns the arguments left after the flags.
+func Load(args []string) (*AppConfig, []string, error) {
+	return load(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (*AppConfig, []string, error) {
+	flags, configFile, rest, err := parseFlags(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if configFile == "" {
+		configFile, _ = lookupEnv(envConfigFile)
+	}
+
+	config := Default()
+	if configFile != "" {
+		if err = readFile(config, configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, opt := range options {
+		value, ok := lookupEnv(opt.env)
+		if !ok {
+			continue
+		}
+
+		if err = opt.set(config, value); err != nil {
+			return nil, nil, fmt.Errorf("%s: invalid value of %s: %v", opt.key, opt.env, err)
+		}
+	}
+
+	for _, opt := range options {
+		value, ok := flags[opt.flag]
+		if !ok {
+			continue
+		}
+
+		if err = opt.set(config, value); err != nil {
+			return nil, nil, fmt.Errorf("%s: invalid value of -%s: %v", opt.key, opt.flag, err)
+		}
+	}
+
+	if err = config.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return config, rest, nil
+}
+
+// parseFlags returns the values of the flags given in the arguments, the config file and the rest arguments.
+func parseFlags(args []string) (map[string]string, string, []string, error) {
+	fs := flag.NewFlagSet("gophermart", flag.ContinueOnError)
+	configFile := fs.String(flagConfigFile, "", fmt.Sprintf("YAML config file, env %s", envConfigFile))
+
+	values := make(map[string]string)
+	for _, opt := range options {
+		usage := fmt.Sprintf("%s, env %s, key %s", opt.usage, opt.env, opt.key)
+		name := opt.flag
+		if opt.isBool {
+			fs.BoolFunc(name, usage, func(value string) error {
+				values[name] = value
+				return nil
+			})
+			continue
+		}
+
+		fs.Func(name, usage, func(value string) error {
+			values[name] = value
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", nil, err
+	}
+
+	return values, *configFile, fs.Args(), nil
+}
+
+// readFile reads the YAML file over the config, the unknown keys are errors.
+func readFile(config *AppConfig, configFile string) error {
+	filename, err := filepath.Abs(configFile)
+	if err != nil {
+		return fmt.Errorf("file %s not found: %w", configFile, err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("fail read file %s: %w", configFile, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed unmarshalling config file %s: %v", configFile, err)
+	}
+
+	// the sections set to null in the file stay on the defaults
+	defaults := Default()
+	if config.HTTPConfig == nil {
+		config.HTTPConfig = defaults.HTTPConfig
+	}
+
+	if config.StorageConfig == nil {
+		config.StorageConfig = defaults.StorageConfig
+	}
+
+	if config.AuthConfig == nil {
+		config.AuthConfig = defaults.AuthConfig
+	}
+
+	if config.AccrualConfig == nil {
+		config.AccrualConfig = defaults.AccrualConfig
+	}
+
+	if config.LogConfig == nil {
+		config.LogConfig = defaults.LogConfig
+	}
+
+	if config.TracingConfig == nil {
+		config.TracingConfig = defaults.TracingConfig
+	}
+
+	return nil
+}
+
+func setString(field func(c *AppConfig) *string) func(c *AppConfig, value string) error {
+	return func(c *AppConfig, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setBool(field func(c *AppConfig) *bool) func(c *AppConfig, value string) error {
+	return func(c *AppConfig, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+
+		return nil
+	}
+}
+
+func setInt32(field func(c *AppConfig) *int32) func(c *AppConfig, value string) error {
+	return func(c *AppConfig, value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		*field(c) = int32(parsed)
+
+		return nil
+	}
+}
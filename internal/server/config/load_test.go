@@ -0,0 +1,214 @@
+package gophmarktconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lookupIn returns the environment of the map.
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+// writeConfig writes the YAML config to a temporary file.
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filename, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed write config: %v", err)
+	}
+
+	return filename
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const yamlConfig = `
+storage_type: memory
+http_config:
+  port: 8181
+log_config:
+  level: warn
+accrual_config:
+  concurrency: 2
+`
+
+	tests := []struct {
+		name            string
+		yaml            string
+		env             map[string]string
+		args            []string
+		wantPort        int32
+		wantLevel       string
+		wantConcurrency int
+	}{
+		{
+			name:            "defaults",
+			env:             map[string]string{"STORAGE_TYPE": "memory"},
+			wantPort:        8080,
+			wantLevel:       "info",
+			wantConcurrency: 4,
+		},
+		{
+			name:            "yaml over defaults",
+			yaml:            yamlConfig,
+			wantPort:        8181,
+			wantLevel:       "warn",
+			wantConcurrency: 2,
+		},
+		{
+			name:            "env over yaml",
+			yaml:            yamlConfig,
+			env:             map[string]string{"RUN_ADDRESS": "localhost:8282", "LOG_LEVEL": "debug"},
+			wantPort:        8282,
+			wantLevel:       "debug",
+			wantConcurrency: 2,
+		},
+		{
+			name:            "flags over env",
+			yaml:            yamlConfig,
+			env:             map[string]string{"RUN_ADDRESS": "localhost:8282", "LOG_LEVEL": "debug", "ACCRUAL_CONCURRENCY": "6"},
+			args:            []string{"-a", "localhost:8383", "-l", "error"},
+			wantPort:        8383,
+			wantLevel:       "error",
+			wantConcurrency: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := make(map[string]string)
+			for name, value := range tt.env {
+				env[name] = value
+			}
+			if tt.yaml != "" {
+				env[envConfigFile] = writeConfig(t, tt.yaml)
+			}
+
+			config, _, err := load(tt.args, lookupIn(env))
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			if config.HTTPConfig.Port != tt.wantPort {
+				t.Errorf("http_config.port = %d, want %d", config.HTTPConfig.Port, tt.wantPort)
+			}
+			if config.LogConfig.Level != tt.wantLevel {
+				t.Errorf("log_config.level = %s, want %s", config.LogConfig.Level, tt.wantLevel)
+			}
+			if config.AccrualConfig.Concurrency != tt.wantConcurrency {
+				t.Errorf("accrual_config.concurrency = %d, want %d", config.AccrualConfig.Concurrency, tt.wantConcurrency)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFlag(t *testing.T) {
+	env := map[string]string{envConfigFile: writeConfig(t, "storage_type: memory\nhttp_config:\n  port: 8181\n")}
+	args := []string{"-c", writeConfig(t, "storage_type: memory\nhttp_config:\n  port: 8282\n"), "migrate", "up"}
+
+	config, rest, err := load(args, lookupIn(env))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if config.HTTPConfig.Port != 8282 {
+		t.Errorf("http_config.port = %d, want 8282 of the -c file", config.HTTPConfig.Port)
+	}
+	if strings.Join(rest, " ") != "migrate up" {
+		t.Errorf("rest arguments = %v, want [migrate up]", rest)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			yaml:    "accrual_config:\n  concurency: 2\n",
+			wantErr: "field concurency not found",
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"ACCRUAL_CONCURRENCY": "many"},
+			wantErr: "accrual_config.concurrency: invalid value of ACCRUAL_CONCURRENCY",
+		},
+		{
+			name:    "invalid flag value",
+			args:    []string{"-a", "localhost"},
+			wantErr: "http_config.host, http_config.port: invalid value of -a",
+		},
+		{
+			name:    "port out of range",
+			args:    []string{"-a", "localhost:70000"},
+			wantErr: "http_config.port: must be between 1 and 65535",
+		},
+		{
+			name:    "negative give up attempts",
+			yaml:    "accrual_config:\n  give_up_attempts: -1\n",
+			wantErr: "accrual_config.give_up_attempts: must not be negative",
+		},
+		{
+			name:    "negative breaker threshold",
+			yaml:    "accrual_config:\n  breaker_threshold: -1\n",
+			wantErr: "accrual_config.breaker_threshold: must not be negative",
+		},
+		{
+			name:    "negative breaker timeout",
+			yaml:    "accrual_config:\n  breaker_timeout: -1\n",
+			wantErr: "accrual_config.breaker_timeout: must not be negative",
+		},
+		{
+			name:    "negative fallback delay",
+			yaml:    "accrual_config:\n  fallback_delay: -1\n",
+			wantErr: "accrual_config.fallback_delay: must not be negative",
+		},
+		{
+			name:    "max backoff below min backoff",
+			yaml:    "accrual_config:\n  min_backoff: 10\n  max_backoff: 5\n",
+			wantErr: "accrual_config.max_backoff: must not be less than the minimal backoff 10, got 5",
+		},
+		{
+			name:    "min backoff below fallback delay",
+			yaml:    "accrual_config:\n  min_backoff: 10\n  fallback_delay: 60\n",
+			env:     map[string]string{"ACCRUAL_CALLBACK_SECRET": "secret"},
+			wantErr: "accrual_config.min_backoff: must not be less than accrual_config.fallback_delay 60 with the callback enabled, got 10",
+		},
+		{
+			name:    "max backoff below fallback delay",
+			yaml:    "accrual_config:\n  max_backoff: 30\n",
+			args:    []string{"-cb", "secret"},
+			wantErr: "accrual_config.max_backoff: must not be less than the minimal backoff 60, got 30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"STORAGE_TYPE": "memory"}
+			for name, value := range tt.env {
+				env[name] = value
+			}
+			if tt.yaml != "" {
+				env[envConfigFile] = writeConfig(t, "storage_type: memory\n"+tt.yaml)
+			}
+
+			_, _, err := load(tt.args, lookupIn(env))
+			if err == nil {
+				t.Fatalf("load succeeded, want error %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("load error = %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
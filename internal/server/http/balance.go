@@ -4,6 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+)
+
+const (
+	historyDefaultLimit = 50
+	historyMaxLimit     = 500
 )
 
 func (h *HTTPServer) balanceGet(w http.ResponseWriter, r *http.Request) {
@@ -12,16 +18,54 @@ func (h *HTTPServer) balanceGet(w http.ResponseWriter, r *http.Request) {
 	balance, err := h.storage.GetBalance(r.Context(), login)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed get balance for %s: %v", login, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed get balance for %s", login)))
+		writeError(w, r, internalError("failed get balance for %s", login))
 		return
 	}
 
 	body, err := json.Marshal(balance)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed marshaling balance for %s: %v", login, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed get balance for %s", login)))
+		writeError(w, r, internalError("failed get balance for %s", login))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (h *HTTPServer) balanceHistoryGet(w http.ResponseWriter, r *http.Request) {
+	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
+
+	limit, err := queryInt(r, "limit", historyDefaultLimit)
+	if err != nil || limit <= 0 || limit > historyMaxLimit {
+		writeError(w, r, parameterError("limit", "limit must be between 1 and %d", historyMaxLimit))
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeError(w, r, parameterError("offset", "offset must be a non-negative number"))
+		return
+	}
+
+	entries, err := h.storage.GetLedger(r.Context(), login, limit, offset)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed get balance history for %s: %v", login, err)
+		writeError(w, r, internalError("failed get balance history for %s", login))
+		return
+	}
+
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		w.Write([]byte(fmt.Sprintf("no balance history for %s", login)))
+		return
+	}
+
+	body, err := json.Marshal(entries)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshaling balance history for %s: %v", login, err)
+		writeError(w, r, internalError("failed get balance history for %s", login))
 		return
 	}
 
@@ -29,3 +73,13 @@ func (h *HTTPServer) balanceGet(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(body)
 }
+
+// queryInt reads an integer query parameter with a default value.
+func queryInt(r *http.Request, name string, value int) (int, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return value, nil
+	}
+
+	return strconv.Atoi(param)
+}
@@ -0,0 +1,64 @@
+package gophmarkthttpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+)
+
+const maxCallbackBody = 64 << 10
+
+// AccrualUpdater applies the order states pushed by the accrual system.
+type AccrualUpdater interface {
+	ApplyUpdate(ctx context.Context, update *accrual.AccrualOrder) error
+}
+
+// EnableAccrualCallback serves the pushed accrual updates signed with the secret.
+// It must be called before Start.
+func (h *HTTPServer) EnableAccrualCallback(secret string, updater AccrualUpdater) {
+	h.callbackSecret = secret
+	h.accrualUpdater = updater
+}
+
+func (h *HTTPServer) accrualCallback(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCallbackBody))
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
+		return
+	}
+
+	err = accrual.VerifySignature(
+		h.callbackSecret,
+		r.Header.Get(accrual.TimestampHeader),
+		r.Header.Get(accrual.SignatureHeader),
+		body,
+		time.Now(),
+	)
+	if err != nil {
+		h.logger.Sugar().Warnf("rejected accrual callback: %v", err)
+		writeError(w, r, newAPIError(http.StatusUnauthorized, CodeInvalidSignature, "invalid signature"))
+		return
+	}
+
+	update := &accrual.AccrualOrder{}
+	if err = json.Unmarshal(body, update); err != nil || update.Order == "" {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed unmarshal body"))
+		return
+	}
+
+	err = h.accrualUpdater.ApplyUpdate(r.Context(), update)
+	if err != nil {
+		apiErr := storageAPIError(err, update.Order)
+		if apiErr.Code == CodeInternal {
+			h.logger.Sugar().Errorf("failed apply accrual callback for order %s: %v", update.Order, err)
+		}
+		writeError(w, r, apiErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -15,66 +15,42 @@ func (h *HTTPServer) drawalsPut(w http.ResponseWriter, r *http.Request) {
 	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
 	contentType, ok := r.Header["Content-Type"]
 	if !ok || contentType[0] != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("wrong Content-Type. Expect application/json"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidContentType, "wrong Content-Type. Expect application/json"))
 		return
 	}
 
 	defer r.Body.Close()
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed read body"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
 		return
 	}
 
 	var drawal storage.Drawal
 	err = json.Unmarshal(body, &drawal)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed unmarshal body"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed unmarshal body").withDetails(err.Error()))
 		return
 	}
 
 	ok, err = luhn.IsValid(drawal.Order)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed upload order %s: %v", drawal.Order, err)
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		w.Write([]byte("invalid order number format"))
+		writeError(w, r, newAPIError(http.StatusUnprocessableEntity, CodeInvalidOrderNumber, "invalid order number format"))
 		return
 	}
 
 	if !ok {
 		h.logger.Sugar().Errorf("failed upload order %s: invalid format", drawal.Order)
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		w.Write([]byte("invalid order number format"))
+		writeError(w, r, newAPIError(http.StatusUnprocessableEntity, CodeInvalidOrderNumber, "invalid order number format"))
 		return
 	}
 
 	status, err := h.storage.AddDrawal(r.Context(), drawal.Order, login, drawal.Sum)
-	if err != nil {
-		switch status {
-		case storage.DrawalAddBefore:
-			h.logger.Sugar().Errorf("failed upload drawal order %s: %v", drawal.Order, err)
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(fmt.Sprintf("drawal order %s is already upload", drawal.Order)))
-			return
-		case storage.DrawalAddByOther:
-			h.logger.Sugar().Errorf("failed upload drawal order %s: %v", drawal.Order, err)
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(fmt.Sprintf("drawal order %s is upload by other", drawal.Order)))
-			return
-		case storage.DrawalNotEnoughPoints:
-			h.logger.Sugar().Errorf("failed upload drawal order %s: %v", drawal.Order, err)
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(fmt.Sprintf("not enough points on balance for login %s", login)))
-			return
-		case storage.DrawalOperationFailed:
-			h.logger.Sugar().Errorf("failed upload drawal order %s: %v", drawal.Order, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("drawal order %s is not upload", drawal.Order)))
-			return
-		}
+	if apiErr := resultAPIError(drawalErrors, status, drawal.Order); err != nil && apiErr != nil {
+		h.logger.Sugar().Errorf("failed upload drawal order %s: %v", drawal.Order, err)
+		writeError(w, r, apiErr)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -84,11 +60,16 @@ func (h *HTTPServer) drawalsPut(w http.ResponseWriter, r *http.Request) {
 func (h *HTTPServer) drawalsGet(w http.ResponseWriter, r *http.Request) {
 	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
 
-	drawals, err := h.storage.GetDrawals(r.Context(), login)
+	filter, apiErr := listFilter(r, false)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	drawals, next, err := h.storage.GetDrawals(r.Context(), login, filter)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed get drawal orders for %s: %v", login, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed get drawal orders for %s", login)))
+		writeError(w, r, internalError("failed get drawal orders for %s", login))
 		return
 	}
 
@@ -101,11 +82,14 @@ func (h *HTTPServer) drawalsGet(w http.ResponseWriter, r *http.Request) {
 	body, err := json.Marshal(drawals)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed marshaling drawal orders for %s: %v", login, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed get drawal orders for %s", login)))
+		writeError(w, r, internalError("failed get drawal orders for %s", login))
 		return
 	}
 
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(body)
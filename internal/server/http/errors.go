@@ -0,0 +1,220 @@
+package gophmarkthttpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+type ErrorCode string
+
+const (
+	// request
+	CodeInvalidContentType ErrorCode = "invalid_content_type"
+	CodeInvalidBody        ErrorCode = "invalid_body"
+	CodeInvalidRequest     ErrorCode = "invalid_request"
+	CodeInvalidParameter   ErrorCode = "invalid_parameter"
+	CodeInvalidOrderNumber ErrorCode = "invalid_order_number"
+	CodeNotFound           ErrorCode = "not_found"
+	// authentication
+	CodeUnauthorized      ErrorCode = "unauthorized"
+	CodeUserExists        ErrorCode = "user_exists"
+	CodeUserNotFound      ErrorCode = "user_not_found"
+	CodeWrongPassword     ErrorCode = "wrong_password"
+	CodeUnsuitablePasswd  ErrorCode = "unsuitable_password"
+	CodeSessionClosed     ErrorCode = "session_closed"
+	CodeSessionNotFound   ErrorCode = "session_not_found"
+	CodeRefreshTokenReuse ErrorCode = "refresh_token_reused"
+	// orders
+	CodeOrderConflict   ErrorCode = "order_conflict"
+	CodeOrderNotFound   ErrorCode = "order_not_found"
+	CodeOrderForbidden  ErrorCode = "order_forbidden"
+	CodeOrderTransition ErrorCode = "order_transition"
+	// withdrawals
+	CodeWithdrawalExists   ErrorCode = "withdrawal_exists"
+	CodeWithdrawalConflict ErrorCode = "withdrawal_conflict"
+	CodeInvalidSum         ErrorCode = "invalid_sum"
+	CodeNotEnoughPoints    ErrorCode = "not_enough_points"
+	// accrual callback
+	CodeInvalidSignature ErrorCode = "invalid_signature"
+	CodeInvalidUpdate    ErrorCode = "invalid_update"
+
+	CodeInternal ErrorCode = "internal_error"
+
+	contentTypeProblem = "application/problem+json"
+	problemTypePrefix  = "urn:gophmarkt:error:"
+)
+
+// APIError is the body of every failed response.
+type APIError struct {
+	Status    int         `json:"-"`
+	Code      ErrorCode   `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// ProblemDetails is the RFC 7807 form of APIError for the clients accepting application/problem+json.
+type ProblemDetails struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      ErrorCode   `json:"code"`
+	RequestID string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+func newAPIError(status int, code ErrorCode, format string, args ...interface{}) *APIError {
+	return &APIError{
+		Status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *APIError) withDetails(details interface{}) *APIError {
+	e.Details = details
+	return e
+}
+
+func internalError(format string, args ...interface{}) *APIError {
+	return newAPIError(http.StatusInternalServerError, CodeInternal, format, args...)
+}
+
+// writeError sends the error as the envelope or as the problem details when the client prefers them.
+func writeError(w http.ResponseWriter, r *http.Request, apiErr *APIError) {
+	apiErr.RequestID = middleware.GetReqID(r.Context())
+
+	var body interface{} = apiErr
+	contentType := "application/json"
+	if acceptsProblem(r) {
+		contentType = contentTypeProblem
+		body = &ProblemDetails{
+			Type:      problemTypePrefix + string(apiErr.Code),
+			Title:     http.StatusText(apiErr.Status),
+			Status:    apiErr.Status,
+			Detail:    apiErr.Message,
+			Instance:  r.URL.Path,
+			Code:      apiErr.Code,
+			RequestID: apiErr.RequestID,
+			Details:   apiErr.Details,
+		}
+	}
+
+	response, err := json.Marshal(body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(apiErr.Status)
+	w.Write(response)
+}
+
+// acceptsProblem checks the Accept header for application/problem+json with a non-zero quality.
+func acceptsProblem(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || mediaType != contentTypeProblem {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// resultError is the API error of a storage operation result, the message gets the subject of the operation.
+type resultError struct {
+	status  int
+	code    ErrorCode
+	message string
+}
+
+// the storage operation results mapped to the API errors, the results missing here are not errors
+var (
+	registrationErrors = map[storage.UserOperationResult]resultError{
+		storage.UserExist:           {http.StatusConflict, CodeUserExists, "user %s is already exists"},
+		storage.UserPasswordWrong:   {http.StatusBadRequest, CodeUnsuitablePasswd, "password of user %s is unsuitable"},
+		storage.UserOperationFailed: {http.StatusInternalServerError, CodeInternal, "user %s is not registered"},
+	}
+	loginErrors = map[storage.UserOperationResult]resultError{
+		storage.UserNotFound:        {http.StatusUnauthorized, CodeUserNotFound, "user %s is not found"},
+		storage.UserPasswordWrong:   {http.StatusUnauthorized, CodeWrongPassword, "incorrect password of user %s"},
+		storage.UserOperationFailed: {http.StatusInternalServerError, CodeInternal, "authentication of user %s failed"},
+	}
+	orderErrors = map[storage.OrderOperationResult]resultError{
+		storage.OrderAddByOther:      {http.StatusConflict, CodeOrderConflict, "order %s is upload by other"},
+		storage.OrderAddError:        {http.StatusUnprocessableEntity, CodeInvalidOrderNumber, "order %s is not accepted"},
+		storage.OrderOperationFailed: {http.StatusInternalServerError, CodeInternal, "order %s is not upload"},
+	}
+	drawalErrors = map[storage.DrawalOperationResult]resultError{
+		storage.DrawalAddBefore:       {http.StatusConflict, CodeWithdrawalExists, "drawal order %s is already upload"},
+		storage.DrawalAddByOther:      {http.StatusConflict, CodeWithdrawalConflict, "drawal order %s is upload by other"},
+		storage.DrawalAddError:        {http.StatusUnprocessableEntity, CodeInvalidSum, "invalid drawal sum of order %s"},
+		storage.DrawalNotEnoughPoints: {http.StatusPaymentRequired, CodeNotEnoughPoints, "not enough points on balance for drawal order %s"},
+		storage.DrawalOperationFailed: {http.StatusInternalServerError, CodeInternal, "drawal order %s is not upload"},
+	}
+	sessionErrors = map[storage.SessionOperationResult]resultError{
+		storage.SessionNotFound:        {http.StatusUnauthorized, CodeSessionClosed, "session %s is closed"},
+		storage.SessionRevoked:         {http.StatusUnauthorized, CodeSessionClosed, "session %s is closed"},
+		storage.SessionExpired:         {http.StatusUnauthorized, CodeSessionClosed, "session %s is closed"},
+		storage.SessionRefreshReused:   {http.StatusUnauthorized, CodeRefreshTokenReuse, "refresh token of session %s is already used, session is revoked"},
+		storage.SessionOperationFailed: {http.StatusInternalServerError, CodeInternal, "authentication error of session %s"},
+	}
+	revokeErrors = map[storage.SessionOperationResult]resultError{
+		storage.SessionNotFound:        {http.StatusNotFound, CodeSessionNotFound, "session %s is not found"},
+		storage.SessionRevoked:         {http.StatusNotFound, CodeSessionNotFound, "session %s is not found"},
+		storage.SessionExpired:         {http.StatusNotFound, CodeSessionNotFound, "session %s is not found"},
+		storage.SessionOperationFailed: {http.StatusInternalServerError, CodeInternal, "session %s is not revoked"},
+	}
+)
+
+// resultAPIError returns the API error of the operation result, nil for the results that are not errors.
+func resultAPIError[T comparable](errs map[T]resultError, result T, subject string) *APIError {
+	e, ok := errs[result]
+	if !ok {
+		return nil
+	}
+
+	return newAPIError(e.status, e.code, e.message, subject)
+}
+
+// storageAPIError maps the errors of the storage and the accrual updates, unknown errors are internal.
+func storageAPIError(err error, subject string) *APIError {
+	switch {
+	case errors.Is(err, storage.ErrOrderNotFound):
+		return newAPIError(http.StatusNotFound, CodeOrderNotFound, "order %s not found", subject)
+	case errors.Is(err, storage.ErrOrderForeign):
+		return newAPIError(http.StatusForbidden, CodeOrderForbidden, "order %s is upload by other", subject)
+	case errors.Is(err, storage.ErrOrderTransition):
+		return newAPIError(http.StatusConflict, CodeOrderTransition, "%v", err)
+	case errors.Is(err, accrual.ErrInvalidUpdate):
+		return newAPIError(http.StatusBadRequest, CodeInvalidUpdate, "%v", err)
+	}
+
+	return internalError("failed process %s", subject)
+}
@@ -0,0 +1,157 @@
+package gophmarkthttpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// time limit of every readiness check
+	readinessTimeout = 2 * time.Second
+
+	healthOK   = "ok"
+	healthFail = "fail"
+
+	checkShutdown = "shutdown"
+)
+
+var errShuttingDown = errors.New("service is shutting down")
+
+type (
+	// ReadinessCheck returns an error while the dependency cannot serve the requests.
+	ReadinessCheck func(ctx context.Context) error
+
+	namedCheck struct {
+		name  string
+		check ReadinessCheck
+		// the failure is reported without failing the readiness
+		optional bool
+	}
+
+	// HealthStatus is the answer of the health endpoints.
+	HealthStatus struct {
+		Status string                  `json:"status"`
+		Checks map[string]*CheckResult `json:"checks,omitempty"`
+	}
+
+	// CheckResult is the state of one dependency.
+	CheckResult struct {
+		Status     string  `json:"status"`
+		Error      string  `json:"error,omitempty"`
+		DurationMS float64 `json:"duration_ms"`
+		Optional   bool    `json:"optional,omitempty"`
+	}
+)
+
+// AddReadinessCheck makes the readiness depend on the check under the name.
+// It must be called before Start.
+func (h *HTTPServer) AddReadinessCheck(name string, check ReadinessCheck) {
+	h.readiness = append(h.readiness, namedCheck{name: name, check: check})
+}
+
+// AddOptionalCheck reports the check under the name in the readiness answer, its failure keeps the service ready.
+// It is meant for the dependencies only some of the requests need. It must be called before Start.
+func (h *HTTPServer) AddOptionalCheck(name string, check ReadinessCheck) {
+	h.readiness = append(h.readiness, namedCheck{name: name, check: check, optional: true})
+}
+
+// Drain fails the readiness so the load balancers stop sending the new requests.
+func (h *HTTPServer) Drain() {
+	h.draining.Store(true)
+}
+
+// healthzGet answers while the process is alive.
+func (h *HTTPServer) healthzGet(w http.ResponseWriter, r *http.Request) {
+	h.writeHealth(w, r, http.StatusOK, &HealthStatus{Status: healthOK})
+}
+
+// readyzGet runs all the readiness checks in parallel.
+func (h *HTTPServer) readyzGet(w http.ResponseWriter, r *http.Request) {
+	checks := append([]namedCheck{{name: checkShutdown, check: h.checkShutdown}}, h.readiness...)
+	results := make([]*CheckResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			results[i] = runCheck(r.Context(), check.check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	health := &HealthStatus{
+		Status: healthOK,
+		Checks: make(map[string]*CheckResult, len(checks)),
+	}
+	status := http.StatusOK
+	for i, check := range checks {
+		results[i].Optional = check.optional
+		health.Checks[check.name] = results[i]
+		if results[i].Status != healthOK && !check.optional {
+			health.Status = healthFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	if status != http.StatusOK {
+		h.logger.Sugar().Warnf("service is not ready: %+v", failedChecks(health))
+	}
+
+	h.writeHealth(w, r, status, health)
+}
+
+func (h *HTTPServer) checkShutdown(ctx context.Context) error {
+	if h.draining.Load() {
+		return errShuttingDown
+	}
+
+	return nil
+}
+
+func runCheck(ctx context.Context, check ReadinessCheck) *CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := &CheckResult{
+		Status:     healthOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = healthFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func failedChecks(health *HealthStatus) map[string]string {
+	failed := make(map[string]string)
+	for name, result := range health.Checks {
+		if result.Status != healthOK {
+			failed[name] = result.Error
+		}
+	}
+
+	return failed
+}
+
+func (h *HTTPServer) writeHealth(w http.ResponseWriter, r *http.Request, status int, health *HealthStatus) {
+	body, err := json.Marshal(health)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshaling health status: %v", err)
+		writeError(w, r, internalError("failed get health status"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,47 @@
+package gophmarkthttpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReadyzOptionalCheck(t *testing.T) {
+	failing := func(ctx context.Context) error { return errors.New("unreachable") }
+
+	tests := []struct {
+		name       string
+		required   bool
+		wantStatus int
+	}{
+		{name: "optional check keeps the service ready", wantStatus: http.StatusOK},
+		{name: "required check fails the readiness", required: true, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, newMemStorage(t))
+			if tt.required {
+				ts.handler.AddReadinessCheck("dependency", failing)
+			} else {
+				ts.handler.AddOptionalCheck("dependency", failing)
+			}
+
+			resp := ts.do(http.MethodGet, "/readyz", "", "", nil, tt.wantStatus)
+
+			var health HealthStatus
+			if err := json.Unmarshal(resp.body, &health); err != nil {
+				t.Fatalf("failed unmarshal health: %v", err)
+			}
+			result, ok := health.Checks["dependency"]
+			if !ok {
+				t.Fatalf("readiness answer %s has no dependency check", resp.body)
+			}
+			if result.Status != healthFail || result.Optional == tt.required {
+				t.Errorf("dependency check = %+v, want failed with optional %v", result, !tt.required)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package gophmarkthttpserver
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const (
+	listMaxLimit     = 1000
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// listFilter reads the paging, sorting and filtering parameters of the list.
+// limit and cursor page the list, from and to bound the date in RFC3339,
+// sort is asc or desc, status is a comma separated list of the order statuses.
+func listFilter(r *http.Request, withStatus bool) (*storage.ListFilter, *APIError) {
+	limit, err := queryInt(r, "limit", 0)
+	if err != nil || limit < 0 || limit > listMaxLimit {
+		return nil, parameterError("limit", "limit must be a non-negative number up to %d", listMaxLimit)
+	}
+
+	filter := &storage.ListFilter{Limit: limit, Sort: storage.SortDesc}
+	query := r.URL.Query()
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		filter.Cursor, err = storage.DecodeCursor(cursor)
+		if err != nil {
+			return nil, parameterError("cursor", "%v", err)
+		}
+	}
+
+	switch sort := storage.SortOrder(strings.ToLower(query.Get("sort"))); sort {
+	case "":
+	case storage.SortAsc, storage.SortDesc:
+		filter.Sort = sort
+	default:
+		return nil, parameterError("sort", "sort must be %s or %s", storage.SortAsc, storage.SortDesc)
+	}
+
+	for name, value := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		param := query.Get(name)
+		if param == "" {
+			continue
+		}
+
+		*value, err = time.Parse(time.RFC3339, param)
+		if err != nil {
+			return nil, parameterError(name, "%s must be a date in RFC3339", name)
+		}
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, parameterError("from", "from must be before to")
+	}
+
+	if param := query.Get("status"); param != "" {
+		if !withStatus {
+			return nil, parameterError("status", "status filter is not supported")
+		}
+
+		for _, value := range strings.Split(param, ",") {
+			status := storage.OrderStatus(strings.ToUpper(strings.TrimSpace(value)))
+			switch status {
+			case storage.OrderStatusNew, storage.OrderStatusProcessing, storage.OrderStatusInvalid, storage.OrderStatusProcessed:
+				filter.Statuses = append(filter.Statuses, status)
+			default:
+				return nil, parameterError("status", "unknown order status %s", value)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+func parameterError(name, format string, args ...interface{}) *APIError {
+	return newAPIError(http.StatusBadRequest, CodeInvalidParameter, format, args...).
+		withDetails(map[string]string{"parameter": name})
+}
@@ -0,0 +1,166 @@
+package gophmarkthttpserver
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// openapiSpec is the contract of every route of newRouter.
+//
+//go:embed openapi.yaml
+var openapiSpec []byte
+
+var (
+	openapiOnce sync.Once
+	openapiDoc  *openapi3.T
+	openapiJSON []byte
+	openapiErr  error
+)
+
+// OpenAPI returns the validated OpenAPI document of the API.
+func OpenAPI() (*openapi3.T, error) {
+	openapiOnce.Do(func() {
+		loader := openapi3.NewLoader()
+		openapiDoc, openapiErr = loader.LoadFromData(openapiSpec)
+		if openapiErr != nil {
+			openapiErr = fmt.Errorf("failed load OpenAPI document: %v", openapiErr)
+			return
+		}
+
+		if openapiErr = openapiDoc.Validate(loader.Context); openapiErr != nil {
+			openapiErr = fmt.Errorf("invalid OpenAPI document: %v", openapiErr)
+			return
+		}
+
+		openapiJSON, openapiErr = json.Marshal(openapiDoc)
+	})
+
+	return openapiDoc, openapiErr
+}
+
+func (h *HTTPServer) openapiGet(w http.ResponseWriter, r *http.Request) {
+	if _, err := OpenAPI(); err != nil {
+		h.logger.Sugar().Errorf("failed get OpenAPI document: %v", err)
+		writeError(w, r, internalError("failed get OpenAPI document"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapiJSON)
+}
+
+// EnableAPIValidation checks every request and response of the documented routes against the OpenAPI document.
+// An invalid request is rejected, an invalid response is replaced by an internal error.
+// It is meant for the tests and the development, it must be called before Start.
+func (h *HTTPServer) EnableAPIValidation() error {
+	doc, err := OpenAPI()
+	if err != nil {
+		return err
+	}
+
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return fmt.Errorf("failed init OpenAPI router: %v", err)
+	}
+	h.apiRouter = router
+
+	return nil
+}
+
+// apiValidation is the middleware of EnableAPIValidation.
+func (h *HTTPServer) apiValidation(next http.Handler) http.Handler {
+	options := &openapi3filter.Options{
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		IncludeResponseStatus: true,
+		MultiError:            true,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := h.apiRouter.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the request body is read by the validation and restored for the handler
+		var body []byte
+		if r.Body != nil {
+			body, err = io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestInput := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+		if err = openapi3filter.ValidateRequest(r.Context(), requestInput); err != nil {
+			h.logger.Sugar().Debugf("request %s %s diverges from OpenAPI: %v", r.Method, r.URL.Path, err)
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "request diverges from the API").
+				withDetails(err.Error()))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		recorder := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		// the same content type net/http sniffs for the response without it
+		if recorder.header.Get("Content-Type") == "" && recorder.body.Len() > 0 {
+			recorder.header.Set("Content-Type", http.DetectContentType(recorder.body.Bytes()))
+		}
+
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: requestInput,
+			Status:                 recorder.status,
+			Header:                 recorder.header,
+			Body:                   io.NopCloser(bytes.NewReader(recorder.body.Bytes())),
+			Options:                options,
+		})
+		if err != nil {
+			h.logger.Sugar().Errorf("response %d of %s %s diverges from OpenAPI: %v", recorder.status, r.Method, r.URL.Path, err)
+			writeError(w, r, internalError("response diverges from the API").withDetails(err.Error()))
+			return
+		}
+
+		for name, values := range recorder.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(recorder.status)
+		w.Write(recorder.body.Bytes())
+	})
+}
+
+// responseRecorder keeps the response of the handler until it is validated.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
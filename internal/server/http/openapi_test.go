@@ -0,0 +1,212 @@
+package gophmarkthttpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+)
+
+// TestAPIContract goes through every documented route with the OpenAPI validation of the responses.
+func TestAPIContract(t *testing.T) {
+	ts := newTestServer(t, newMemStorage(t))
+	const (
+		jsonType = "application/json"
+		textType = "text/plain"
+	)
+
+	// service
+	ts.do(http.MethodGet, "/ping", "", "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/healthz", "", "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/readyz", "", "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/metrics", "", "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/openapi.json", "", "", nil, http.StatusOK)
+
+	// users
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	ts.do(http.MethodPost, "/api/user/register", "", jsonType, credentials("alice", testPassword), http.StatusConflict)
+	ts.do(http.MethodPost, "/api/user/register", "", textType, credentials("carol", testPassword), http.StatusBadRequest)
+
+	login := ts.do(http.MethodPost, "/api/user/login", "", jsonType, credentials("alice", testPassword), http.StatusOK)
+	ts.do(http.MethodPost, "/api/user/login", "", jsonType, credentials("alice", "wrong"), http.StatusUnauthorized)
+	ts.do(http.MethodPost, "/api/user/login", "", jsonType, credentials("nobody", testPassword), http.StatusUnauthorized)
+
+	// sessions
+	refresh, _ := json.Marshal(RefreshBody{RefreshToken: login.header.Get(headerRefreshToken)})
+	refreshed := ts.do(http.MethodPost, "/api/user/token/refresh", "", jsonType, refresh, http.StatusOK)
+	var tokens TokenBody
+	if err := json.Unmarshal(refreshed.body, &tokens); err != nil {
+		t.Fatalf("failed unmarshal tokens: %v", err)
+	}
+	bogus, _ := json.Marshal(RefreshBody{RefreshToken: "bogus"})
+	ts.do(http.MethodPost, "/api/user/token/refresh", "", jsonType, bogus, http.StatusUnauthorized)
+	ts.do(http.MethodPost, "/api/user/token/refresh", "", "", nil, http.StatusBadRequest)
+
+	list := ts.do(http.MethodGet, "/api/user/sessions", alice, "", nil, http.StatusOK)
+	var sessions []struct {
+		ID      string `json:"id"`
+		Current bool   `json:"current"`
+	}
+	if err := json.Unmarshal(list.body, &sessions); err != nil {
+		t.Fatalf("failed unmarshal sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("alice has %d sessions, want 2", len(sessions))
+	}
+	ts.do(http.MethodGet, "/api/user/sessions", "", "", nil, http.StatusUnauthorized)
+
+	for _, session := range sessions {
+		if !session.Current {
+			ts.do(http.MethodDelete, "/api/user/sessions/"+session.ID, alice, "", nil, http.StatusOK)
+			ts.do(http.MethodDelete, "/api/user/sessions/"+session.ID, alice, "", nil, http.StatusNotFound)
+		}
+	}
+	ts.do(http.MethodGet, "/api/user/balance", authSchemeBearer+tokens.AccessToken, "", nil, http.StatusUnauthorized)
+
+	// orders
+	ts.do(http.MethodGet, "/api/user/orders", alice, "", nil, http.StatusNoContent)
+	ts.do(http.MethodPost, "/api/user/orders", alice, textType, []byte("12345678903"), http.StatusAccepted)
+	ts.do(http.MethodPost, "/api/user/orders", alice, textType, []byte("12345678903"), http.StatusOK)
+	ts.do(http.MethodPost, "/api/user/orders", bob, textType, []byte("12345678903"), http.StatusConflict)
+	ts.do(http.MethodPost, "/api/user/orders", alice, textType, []byte("12345678904"), http.StatusUnprocessableEntity)
+	ts.do(http.MethodPost, "/api/user/orders", "", textType, []byte("79927398713"), http.StatusUnauthorized)
+
+	ts.do(http.MethodPost, "/api/user/orders/batch", alice, jsonType, []byte(`["79927398713", 4561261212345467, "1234"]`), http.StatusOK)
+	ts.do(http.MethodPost, "/api/user/orders/batch", alice, textType, []byte("12345678903\n79927398713\n"), http.StatusOK)
+	ts.do(http.MethodPost, "/api/user/orders/batch", alice, textType, []byte(strings.Repeat("12345678903\n", 7000)), http.StatusRequestEntityTooLarge)
+
+	ts.do(http.MethodGet, "/api/user/orders", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/orders?limit=1&sort=asc", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/orders?status=NEW,PROCESSED", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/orders?cursor=bogus", alice, "", nil, http.StatusBadRequest)
+	ts.do(http.MethodGet, "/api/user/orders", bob, "", nil, http.StatusNoContent)
+
+	ts.do(http.MethodGet, "/api/user/orders/12345678903", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/orders/12345678903", bob, "", nil, http.StatusForbidden)
+	ts.do(http.MethodGet, "/api/user/orders/2377225624", alice, "", nil, http.StatusNotFound)
+
+	// accrual callback
+	update := []byte(`{"order":"12345678903","status":"PROCESSED","accrual":500}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	ts.callback(update, timestamp, accrual.Sign(testCallbackSecret, timestamp, update), http.StatusOK)
+	ts.callback(update, timestamp, accrual.Sign("other", timestamp, update), http.StatusUnauthorized)
+	unknownOrder := []byte(`{"order":"2377225624","status":"PROCESSED","accrual":500}`)
+	ts.callback(unknownOrder, timestamp, accrual.Sign(testCallbackSecret, timestamp, unknownOrder), http.StatusNotFound)
+
+	// balance
+	balance := ts.do(http.MethodGet, "/api/user/balance", alice, "", nil, http.StatusOK)
+	if !strings.Contains(string(balance.body), `"current":500`) {
+		t.Errorf("balance of alice is %s, want 500 points", balance.body)
+	}
+
+	ts.do(http.MethodGet, "/api/user/withdrawals", alice, "", nil, http.StatusNoContent)
+	withdraw := []byte(`{"order":"2377225624","sum":100.5}`)
+	ts.do(http.MethodPost, "/api/user/balance/withdraw", alice, jsonType, withdraw, http.StatusOK)
+	ts.do(http.MethodPost, "/api/user/balance/withdraw", alice, jsonType, withdraw, http.StatusConflict)
+	ts.do(http.MethodPost, "/api/user/balance/withdraw", alice, jsonType, []byte(`{"order":"79927398713","sum":1000}`), http.StatusPaymentRequired)
+	ts.do(http.MethodPost, "/api/user/balance/withdraw", alice, jsonType, []byte(`{"order":"12345678904","sum":1}`), http.StatusUnprocessableEntity)
+	ts.do(http.MethodPost, "/api/user/balance/withdraw", bob, jsonType, []byte(`{"order":"79927398713","sum":1}`), http.StatusPaymentRequired)
+
+	ts.do(http.MethodGet, "/api/user/withdrawals", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/withdrawals?limit=1", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/withdrawals", bob, "", nil, http.StatusNoContent)
+
+	ts.do(http.MethodGet, "/api/user/balance/history", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/balance/history?limit=1&offset=1", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/balance/history", bob, "", nil, http.StatusNoContent)
+
+	// shutdown
+	ts.do(http.MethodPost, "/api/user/logout", alice, "", nil, http.StatusOK)
+	ts.do(http.MethodGet, "/api/user/balance", alice, "", nil, http.StatusUnauthorized)
+	ts.handler.Drain()
+	ts.do(http.MethodGet, "/readyz", "", "", nil, http.StatusServiceUnavailable)
+
+	if missed := ts.uncovered(); len(missed) > 0 {
+		t.Errorf("documented routes without requests: %v", missed)
+	}
+}
+
+func (ts *testServer) callback(body []byte, timestamp, signature string, wantStatus int) {
+	ts.t.Helper()
+
+	header := http.Header{}
+	header.Set(accrual.TimestampHeader, timestamp)
+	header.Set(accrual.SignatureHeader, signature)
+	resp := ts.send(http.MethodPost, "/internal/accrual/callback", "", "application/json", body, header)
+	if resp.status != wantStatus {
+		ts.t.Errorf("accrual callback: status %d, want %d, body: %s", resp.status, wantStatus, resp.body)
+	}
+}
+
+// TestAPIValidationRejectsDivergingResponse makes sure the contract test fails on a broken handler.
+func TestAPIValidationRejectsDivergingResponse(t *testing.T) {
+	h := &HTTPServer{logger: zap.NewNop()}
+	if err := h.EnableAPIValidation(); err != nil {
+		t.Fatalf("failed enable API validation: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{
+			name:        "valid response",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `[{"order":"2377225624","sum":100,"processed_at":"2024-07-01T12:00:00Z"}]`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "missing processed_at",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `[{"order":"2377225624","sum":100}]`,
+			wantStatus:  http.StatusInternalServerError,
+		},
+		{
+			name:        "undocumented status",
+			status:      http.StatusCreated,
+			contentType: "application/json",
+			body:        `[]`,
+			wantStatus:  http.StatusInternalServerError,
+		},
+		{
+			name:        "wrong content type",
+			status:      http.StatusOK,
+			contentType: "text/plain",
+			body:        "withdrawals",
+			wantStatus:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := h.apiValidation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/user/withdrawals", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d, body: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusInternalServerError && !strings.Contains(rec.Body.String(), "response diverges from the API") {
+				t.Errorf("body %s does not report the divergence", rec.Body)
+			}
+		})
+	}
+}
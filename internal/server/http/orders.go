@@ -2,11 +2,14 @@ package gophmarkthttpserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	luhn "github.com/EClaesson/go-luhn"
+	"github.com/go-chi/chi/v5"
 
 	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
 )
@@ -15,16 +18,14 @@ func (h *HTTPServer) ordersPut(w http.ResponseWriter, r *http.Request) {
 	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
 	contentType, ok := r.Header["Content-Type"]
 	if !ok || contentType[0] != "text/plain" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("wrong Content-Type. Expect text/plain"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidContentType, "wrong Content-Type. Expect text/plain"))
 		return
 	}
 
 	defer r.Body.Close()
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed read body"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
 		return
 	}
 
@@ -32,37 +33,28 @@ func (h *HTTPServer) ordersPut(w http.ResponseWriter, r *http.Request) {
 	ok, err = luhn.IsValid(orderID)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed upload order %s: %v", orderID, err)
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		w.Write([]byte("invalid order number format"))
+		writeError(w, r, newAPIError(http.StatusUnprocessableEntity, CodeInvalidOrderNumber, "invalid order number format"))
 		return
 	}
 
 	if !ok {
 		h.logger.Sugar().Errorf("failed upload order %s: invalid format", orderID)
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		w.Write([]byte("invalid order number format"))
+		writeError(w, r, newAPIError(http.StatusUnprocessableEntity, CodeInvalidOrderNumber, "invalid order number format"))
 		return
 	}
 
 	status, err := h.storage.AddOrder(r.Context(), orderID, login)
-	if err != nil {
-		switch status {
-		case storage.OrderAddBefore:
-			h.logger.Sugar().Errorf("failed upload order %s: %v", orderID, err)
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(fmt.Sprintf("order %s is already exists", orderID)))
-			return
-		case storage.OrderAddByOther:
-			h.logger.Sugar().Errorf("failed upload order %s: %v", orderID, err)
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(fmt.Sprintf("order %s is upload by other", orderID)))
-			return
-		case storage.OrderOperationFailed:
-			h.logger.Sugar().Errorf("failed upload order %s: %v", orderID, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("order %s is not upload", orderID)))
-			return
-		}
+	if err != nil && status == storage.OrderAddBefore {
+		h.logger.Sugar().Errorf("failed upload order %s: %v", orderID, err)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("order %s is already exists", orderID)))
+		return
+	}
+
+	if apiErr := resultAPIError(orderErrors, status, orderID); err != nil && apiErr != nil {
+		h.logger.Sugar().Errorf("failed upload order %s: %v", orderID, err)
+		writeError(w, r, apiErr)
+		return
 	}
 
 	w.WriteHeader(http.StatusAccepted)
@@ -72,11 +64,16 @@ func (h *HTTPServer) ordersPut(w http.ResponseWriter, r *http.Request) {
 func (h *HTTPServer) ordersGet(w http.ResponseWriter, r *http.Request) {
 	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
 
-	orders, err := h.storage.GetOrders(r.Context(), login)
+	filter, apiErr := listFilter(r, true)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	orders, next, err := h.storage.GetOrders(r.Context(), login, filter)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed get orders for %s: %v", login, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed get orders for %s", login)))
+		writeError(w, r, internalError("failed get orders for %s", login))
 		return
 	}
 
@@ -89,8 +86,62 @@ func (h *HTTPServer) ordersGet(w http.ResponseWriter, r *http.Request) {
 	body, err := json.Marshal(orders)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed marshaling orders for %s: %v", login, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed get orders for %s", login)))
+		writeError(w, r, internalError("failed get orders for %s", login))
+		return
+	}
+
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+type OrderBody struct {
+	Number     string                `json:"number"`
+	Status     storage.OrderStatus   `json:"status"`
+	Accrual    storage.Points        `json:"accrual,omitempty"`
+	UploadedAt time.Time             `json:"uploaded_at"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+	Events     []*storage.OrderEvent `json:"events"`
+}
+
+func (h *HTTPServer) orderGet(w http.ResponseWriter, r *http.Request) {
+	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
+	orderID := chi.URLParam(r, "number")
+
+	order, err := h.storage.GetOrder(r.Context(), orderID, login)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOrderForeign):
+			h.logger.Sugar().Warnf("user %s requested order %s of other user", login, orderID)
+		case !errors.Is(err, storage.ErrOrderNotFound):
+			h.logger.Sugar().Errorf("failed get order %s for %s: %v", orderID, login, err)
+		}
+		writeError(w, r, storageAPIError(err, orderID))
+		return
+	}
+
+	events, err := h.storage.GetOrderEvents(r.Context(), orderID, login)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed get events of order %s for %s: %v", orderID, login, err)
+		writeError(w, r, internalError("failed get order %s", orderID))
+		return
+	}
+
+	body, err := json.Marshal(&OrderBody{
+		Number:     order.Number,
+		Status:     order.Status,
+		Accrual:    order.Accrual,
+		UploadedAt: order.UploadedAt,
+		UpdatedAt:  order.UpdatedAt,
+		Events:     events,
+	})
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshaling order %s for %s: %v", orderID, login, err)
+		writeError(w, r, internalError("failed get order %s", orderID))
 		return
 	}
 
@@ -0,0 +1,156 @@
+package gophmarkthttpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	luhn "github.com/EClaesson/go-luhn"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const (
+	orderBatchMaxSize = 1000
+	// room for the quoted numbers of orderBatchMaxSize with separators and spaces
+	orderBatchMaxBody = orderBatchMaxSize * 64
+)
+
+type (
+	// OrderNumber is the order number given as a JSON string or a JSON number.
+	OrderNumber      string
+	OrderBatchResult struct {
+		Number string `json:"number"`
+		Result string `json:"result"`
+		// code of the single upload of the number
+		Code int `json:"code"`
+	}
+)
+
+func (n *OrderNumber) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("order number must be a string or a number: %v", err)
+	}
+	*n = OrderNumber(number)
+
+	return nil
+}
+
+// batch results of the number, the codes are the same as of the single upload
+var orderBatchResults = map[storage.OrderOperationResult]OrderBatchResult{
+	storage.OrderAddSuccess:      {Result: "accepted", Code: http.StatusAccepted},
+	storage.OrderAddBefore:       {Result: "exists", Code: http.StatusOK},
+	storage.OrderAddByOther:      {Result: "conflict", Code: http.StatusConflict},
+	storage.OrderOperationFailed: {Result: "failed", Code: http.StatusInternalServerError},
+}
+
+// ordersBatchPut uploads a JSON array or newline separated order numbers in one transaction.
+// The numbers failing the Luhn check are reported as invalid and skipped.
+func (h *HTTPServer) ordersBatchPut(w http.ResponseWriter, r *http.Request) {
+	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, orderBatchMaxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, newAPIError(http.StatusRequestEntityTooLarge, CodeInvalidBody, "body is larger than %d bytes", orderBatchMaxBody).
+				withDetails(map[string]int{"max_size": orderBatchMaxSize, "max_body": orderBatchMaxBody}))
+			return
+		}
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
+		return
+	}
+
+	numbers, apiErr := parseOrderBatch(r.Header.Get("Content-Type"), body)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	if len(numbers) == 0 || len(numbers) > orderBatchMaxSize {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "batch must contain from 1 to %d order numbers", orderBatchMaxSize).
+			withDetails(map[string]int{"size": len(numbers), "max_size": orderBatchMaxSize}))
+		return
+	}
+
+	results := make([]OrderBatchResult, len(numbers))
+	valid := make([]string, 0, len(numbers))
+	for i, number := range numbers {
+		results[i] = OrderBatchResult{Number: number, Result: "invalid", Code: http.StatusUnprocessableEntity}
+		if ok, err := luhn.IsValid(number); err == nil && ok {
+			valid = append(valid, number)
+		}
+	}
+
+	statuses, err := h.storage.AddOrders(r.Context(), valid, login)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed upload batch of %d orders for %s: %v", len(valid), login, err)
+		writeError(w, r, internalError("orders are not upload"))
+		return
+	}
+
+	j := 0
+	for i := range results {
+		if j < len(valid) && results[i].Number == valid[j] {
+			result := orderBatchResults[statuses[j]]
+			result.Number = valid[j]
+			results[i] = result
+			j++
+		}
+	}
+
+	response, err := json.Marshal(results)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshaling batch results for %s: %v", login, err)
+		writeError(w, r, internalError("failed marshaling batch results"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// parseOrderBatch reads the order numbers from a JSON array or from the lines of a text.
+func parseOrderBatch(contentType string, body []byte) ([]string, *APIError) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, CodeInvalidContentType, "wrong Content-Type. Expect application/json or text/plain")
+	}
+
+	numbers := make([]string, 0)
+	switch mediaType {
+	case "application/json":
+		var batch []OrderNumber
+		if err = json.Unmarshal(body, &batch); err != nil {
+			return nil, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed unmarshal order numbers").withDetails(err.Error())
+		}
+
+		for _, number := range batch {
+			numbers = append(numbers, string(number))
+		}
+	case "text/plain":
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			if number := strings.TrimSpace(scanner.Text()); number != "" {
+				numbers = append(numbers, number)
+			}
+		}
+
+		if err = scanner.Err(); err != nil {
+			return nil, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read order numbers").withDetails(err.Error())
+		}
+	default:
+		return nil, newAPIError(http.StatusBadRequest, CodeInvalidContentType, "wrong Content-Type. Expect application/json or text/plain")
+	}
+
+	return numbers, nil
+}
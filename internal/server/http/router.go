@@ -5,12 +5,15 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+
+	tracing "github.com/zvfkjytytw/gophmarkt/internal/server/tracing"
 )
 
 type contextKey int
 
 const (
 	contextAuthUser contextKey = iota
+	contextSessionID
 )
 
 func (h *HTTPServer) newRouter() chi.Router {
@@ -18,8 +21,15 @@ func (h *HTTPServer) newRouter() chi.Router {
 
 	r.Use(middleware.StripSlashes)
 	r.Use(middleware.RequestID)
+	if h.metrics != nil {
+		r.Use(h.metrics.HTTP)
+	}
+	r.Use(tracing.HTTP)
 	r.Use(middleware.Recoverer)
 	r.Use(Logging(h.logger))
+	if h.apiRouter != nil {
+		r.Use(h.apiValidation)
+	}
 
 	// ping handler.
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
@@ -27,20 +37,51 @@ func (h *HTTPServer) newRouter() chi.Router {
 		w.Write([]byte("pong"))
 	})
 
+	// liveness and readiness of the service
+	r.Get("/healthz", h.healthzGet)
+	r.Get("/readyz", h.readyzGet)
+
+	// metrics of the service
+	if h.metrics != nil {
+		r.Method(http.MethodGet, "/metrics", h.metrics.Handler())
+	}
+
+	// OpenAPI document of the API
+	r.Get("/api/openapi.json", h.openapiGet)
+
 	// user registration
 	r.Post("/api/user/register", h.userRegistration)
 	// user authentication
 	r.Post("/api/user/login", h.userLogin)
+	// exchange of the refresh token for a new pair of tokens
+	r.Post("/api/user/token/refresh", h.tokenRefresh)
+
+	// order states pushed by the accrual system
+	if h.accrualUpdater != nil {
+		r.Post("/internal/accrual/callback", h.accrualCallback)
+	}
 
 	// handlers for authenticated users
 	r.Group(func(r chi.Router) {
 		r.Use(h.authUserCtx)
+		// closing the current session
+		r.Post("/api/user/logout", h.userLogout)
+		// getting a list of active sessions of the user
+		r.Get("/api/user/sessions", h.sessionsGet)
+		// revoking the session of the user
+		r.Delete("/api/user/sessions/{id}", h.sessionsDelete)
 		// uploading the order number for calculation
 		r.Post("/api/user/orders", h.ordersPut)
+		// uploading the batch of order numbers for calculation
+		r.Post("/api/user/orders/batch", h.ordersBatchPut)
 		// getting a list of orders uploaded by the user
 		r.Get("/api/user/orders", h.ordersGet)
+		// getting the order of the user with the history of its status
+		r.Get("/api/user/orders/{number}", h.orderGet)
 		// getting a balance by the user
 		r.Get("/api/user/balance", h.balanceGet)
+		// getting a history of the balance movements by the user
+		r.Get("/api/user/balance/history", h.balanceHistoryGet)
 		// uploading the order for drawal
 		r.Post("/api/user/balance/withdraw", h.drawalsPut)
 		// getting a list of drawal orders uploaded by the user
@@ -57,6 +98,5 @@ func (h *HTTPServer) newRouter() chi.Router {
 
 // not implemented handlers.
 func notImplementedYet(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("not implemented yet"))
+	writeError(w, r, newAPIError(http.StatusNotFound, CodeNotFound, "not implemented yet"))
 }
@@ -2,48 +2,52 @@ package gophmarkthttpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/getkin/kin-openapi/routers"
 	"go.uber.org/zap"
 
+	auth "github.com/zvfkjytytw/gophmarkt/internal/server/auth"
+	metrics "github.com/zvfkjytytw/gophmarkt/internal/server/metrics"
 	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
 )
 
-const (
-	authTTL       = 60
-	updateAuthTTL = time.Minute
-)
-
-type authUser struct {
-	ttl   int32
-	login string
-}
-
 type Config struct {
 	Host         string `yaml:"host"`
 	Port         int32  `yaml:"port"`
 	ReadTimeout  int32  `yaml:"read_timeout"`
 	WriteTimeout int32  `yaml:"write_timeout"`
 	IdleTimeout  int32  `yaml:"idle_timeout"`
+	// check the requests and responses against the OpenAPI document
+	ValidateAPI bool `yaml:"validate_api"`
+	// time in seconds between the readiness failure and the shutdown for the load balancers to drain the traffic
+	DrainDelay int32 `yaml:"drain_delay"`
 }
 
 type HTTPServer struct {
-	sync.RWMutex
-	server    *http.Server
-	logger    *zap.Logger
-	storage   *storage.PGStorage
-	authUsers map[string]*authUser
+	server         *http.Server
+	logger         *zap.Logger
+	storage        storage.Storage
+	tokens         *auth.TokenManager
+	accrualUpdater AccrualUpdater
+	callbackSecret string
+	apiRouter      routers.Router
+	metrics        *metrics.Metrics
+	readiness      []namedCheck
+	draining       atomic.Bool
 }
 
 func NewHTTPServer(
 	runAddress string,
 	comlog *zap.Logger,
-	storage *storage.PGStorage,
+	storage storage.Storage,
+	tokens *auth.TokenManager,
 ) (*HTTPServer, error) {
 	addr := strings.Split(runAddress, ":")
 	if len(addr) < 2 {
@@ -63,13 +67,14 @@ func NewHTTPServer(
 		IdleTimeout:  10,
 	}
 
-	return NewHTTPServerFromConfig(config, comlog, storage)
+	return NewHTTPServerFromConfig(config, comlog, storage, tokens)
 }
 
 func NewHTTPServerFromConfig(
 	config *Config,
 	comlog *zap.Logger,
-	storage *storage.PGStorage,
+	storage storage.Storage,
+	tokens *auth.TokenManager,
 ) (*HTTPServer, error) {
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
@@ -84,25 +89,35 @@ func NewHTTPServerFromConfig(
 		logger = comlog
 	}
 
-	return &HTTPServer{
-		server:    server,
-		logger:    logger,
-		storage:   storage,
-		authUsers: make(map[string]*authUser),
-	}, nil
+	httpServer := &HTTPServer{
+		server:  server,
+		logger:  logger,
+		storage: storage,
+		tokens:  tokens,
+	}
+
+	if config.ValidateAPI {
+		if err = httpServer.EnableAPIValidation(); err != nil {
+			return nil, err
+		}
+	}
+
+	return httpServer, nil
+}
+
+// EnableMetrics measures the requests and serves the metrics on /metrics.
+// It must be called before Start.
+func (h *HTTPServer) EnableMetrics(m *metrics.Metrics) {
+	h.metrics = m
 }
 
 func (h *HTTPServer) Start(ctx context.Context) error {
 	router := h.newRouter()
 	h.server.Handler = router
 
-	stopCheckAuth := make(chan struct{})
-	defer close(stopCheckAuth)
-	go h.CheckAuth(stopCheckAuth)
-
 	err := h.server.ListenAndServe()
-	if err != nil {
-		h.logger.Sugar().Errorf("failed start http server: %w", err)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		h.logger.Sugar().Errorf("failed start http server: %v", err)
 		return err
 	}
 
@@ -113,13 +128,7 @@ func (h *HTTPServer) Stop(ctx context.Context) error {
 	defer h.logger.Sync()
 	err := h.server.Shutdown(ctx)
 	if err != nil {
-		h.logger.Sugar().Errorf("failed stop http server: %w", err)
-		return err
-	}
-
-	err = h.storage.Close()
-	if err != nil {
-		h.logger.Sugar().Errorf("failed close storage: %w", err)
+		h.logger.Sugar().Errorf("failed stop http server: %v", err)
 		return err
 	}
 
@@ -142,26 +151,3 @@ func initLogger(comlog *zap.Logger) (*zap.Logger, error) {
 
 	return logger, nil
 }
-
-func (h *HTTPServer) CheckAuth(stop chan struct{}) {
-	ticker := time.NewTicker(updateAuthTTL)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-stop:
-			return
-		case <-ticker.C:
-			func() {
-				h.Lock()
-				defer h.Unlock()
-				for token, user := range h.authUsers {
-					if user.ttl <= 0 {
-						delete(h.authUsers, token)
-					} else {
-						user.ttl--
-					}
-				}
-			}()
-		}
-	}
-}
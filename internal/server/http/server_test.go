@@ -0,0 +1,198 @@
+package gophmarkthttpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+	auth "github.com/zvfkjytytw/gophmarkt/internal/server/auth"
+	metrics "github.com/zvfkjytytw/gophmarkt/internal/server/metrics"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const (
+	testPassword       = "Passw0rd"
+	testCallbackSecret = "secret"
+)
+
+// testServer serves newRouter with the OpenAPI validation of every request and response.
+type testServer struct {
+	t       *testing.T
+	handler *HTTPServer
+	server  *httptest.Server
+	storage storage.Storage
+
+	mu sync.Mutex
+	// documented routes the requests went through, "METHOD /path"
+	routes map[string]bool
+}
+
+// testResponse is the read response of the test server.
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newTestServer(t *testing.T, appStorage storage.Storage) *testServer {
+	t.Helper()
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed generate signing key: %v", err)
+	}
+	tokens, err := auth.NewTokenManager(&auth.Config{SigningKeys: []auth.Key{key}, ActiveKey: key.ID})
+	if err != nil {
+		t.Fatalf("failed init token manager: %v", err)
+	}
+
+	logger := zap.NewNop()
+	h := &HTTPServer{
+		logger:  logger,
+		storage: appStorage,
+		tokens:  tokens,
+	}
+	if err = h.EnableAPIValidation(); err != nil {
+		t.Fatalf("failed enable API validation: %v", err)
+	}
+	h.EnableMetrics(metrics.New(logger))
+
+	updater, err := accrual.NewAccrual(&accrual.Config{}, appStorage, logger)
+	if err != nil {
+		t.Fatalf("failed init accrual service: %v", err)
+	}
+	h.EnableAccrualCallback(testCallbackSecret, updater)
+
+	ts := &testServer{
+		t:       t,
+		handler: h,
+		storage: appStorage,
+		routes:  make(map[string]bool),
+	}
+
+	router := h.newRouter()
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, _, err := h.apiRouter.FindRoute(r); err == nil {
+			ts.mu.Lock()
+			ts.routes[route.Method+" "+route.Path] = true
+			ts.mu.Unlock()
+		}
+		router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.server.Close)
+
+	return ts
+}
+
+func newMemStorage(t *testing.T) storage.Storage {
+	t.Helper()
+
+	hasher, err := storage.NewPasswordHasher(storage.HashBcrypt)
+	if err != nil {
+		t.Fatalf("failed init password hasher: %v", err)
+	}
+
+	return storage.NewMemStorage(hasher)
+}
+
+// do sends the request and fails the test when the response diverges from the OpenAPI document
+// or its status is not the expected one.
+func (ts *testServer) do(method, path, token, contentType string, body []byte, wantStatus int) *testResponse {
+	ts.t.Helper()
+
+	resp := ts.send(method, path, token, contentType, body, nil)
+	if resp.status != wantStatus {
+		ts.t.Errorf("%s %s: status %d, want %d, body: %s", method, path, resp.status, wantStatus, resp.body)
+	}
+
+	return resp
+}
+
+func (ts *testServer) send(method, path, token, contentType string, body []byte, header http.Header) *testResponse {
+	ts.t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), method, ts.server.URL+path, bytes.NewReader(body))
+	if err != nil {
+		ts.t.Fatalf("failed init request %s %s: %v", method, path, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set(headerAuthorization, token)
+	}
+
+	resp, err := ts.server.Client().Do(req)
+	if err != nil {
+		ts.t.Fatalf("failed request %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatalf("failed read response of %s %s: %v", method, path, err)
+	}
+
+	if resp.StatusCode == http.StatusInternalServerError && bytes.Contains(respBody, []byte("response diverges from the API")) {
+		ts.t.Errorf("%s %s: %s", method, path, respBody)
+	}
+
+	return &testResponse{status: resp.StatusCode, header: resp.Header, body: respBody}
+}
+
+// register creates the user and returns the authorization header of its session.
+func (ts *testServer) register(login string) string {
+	ts.t.Helper()
+
+	resp := ts.do(http.MethodPost, "/api/user/register", "", "application/json", credentials(login, testPassword), http.StatusOK)
+
+	token := resp.header.Get(headerAuthorization)
+	if !strings.HasPrefix(token, authSchemeBearer) {
+		ts.t.Fatalf("registration of %s returned no token", login)
+	}
+
+	return token
+}
+
+// credentials is the body of the registration and the login.
+func credentials(login, password string) []byte {
+	body, _ := json.Marshal(map[string]string{"login": login, "password": password})
+
+	return body
+}
+
+// uncovered returns the documented routes no request went through.
+func (ts *testServer) uncovered() []string {
+	ts.t.Helper()
+
+	doc, err := OpenAPI()
+	if err != nil {
+		ts.t.Fatalf("failed load OpenAPI document: %v", err)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	missed := make([]string, 0)
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !ts.routes[method+" "+path] {
+				missed = append(missed, method+" "+path)
+			}
+		}
+	}
+
+	return missed
+}
@@ -0,0 +1,262 @@
+package gophmarkthttpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	auth "github.com/zvfkjytytw/gophmarkt/internal/server/auth"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const (
+	cookieRefreshToken = "RefreshToken"
+	headerRefreshToken = "X-Refresh-Token"
+	tokenTypeBearer    = "Bearer"
+)
+
+type RefreshBody struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenBody struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type SessionBody struct {
+	*storage.Session
+	Current bool `json:"current"`
+}
+
+// start a new session and pass its tokens via headers and cookies
+func (h *HTTPServer) startSession(w http.ResponseWriter, r *http.Request, login string) error {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return err
+	}
+
+	refreshToken, refreshHash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := &storage.Session{
+		ID:         sessionID,
+		Login:      login,
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(h.tokens.RefreshTTL()),
+	}
+
+	if err := h.storage.AddSession(r.Context(), session, refreshHash); err != nil {
+		return err
+	}
+
+	_, err = h.setSessionTokens(w, session, refreshToken)
+
+	return err
+}
+
+// issue an access token of the session and pass both tokens via headers and cookies
+func (h *HTTPServer) setSessionTokens(w http.ResponseWriter, session *storage.Session, refreshToken string) (*TokenBody, error) {
+	authToken, expiresAt, err := h.tokens.Issue(session.Login, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieAuthToken,
+		Value:    authToken,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieRefreshToken,
+		Value:    refreshToken,
+		Path:     "/api/user/token",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+	})
+
+	w.Header().Set(headerAuthorization, authSchemeBearer+authToken)
+	w.Header().Set(headerRefreshToken, refreshToken)
+
+	return &TokenBody{
+		AccessToken:  authToken,
+		RefreshToken: refreshToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+	}, nil
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: cookieAuthToken, Path: "/", MaxAge: -1, HttpOnly: true})
+	http.SetCookie(w, &http.Cookie{Name: cookieRefreshToken, Path: "/api/user/token", MaxAge: -1, HttpOnly: true})
+}
+
+// exchange of the refresh token for a new pair of tokens
+func (h *HTTPServer) tokenRefresh(w http.ResponseWriter, r *http.Request) {
+	var refreshToken string
+	if r.Header.Get("Content-Type") == "application/json" {
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
+			return
+		}
+
+		var refreshData RefreshBody
+		err = json.Unmarshal(body, &refreshData)
+		if err != nil {
+			writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed unmarshal body").withDetails(err.Error()))
+			return
+		}
+		refreshToken = refreshData.RefreshToken
+	} else {
+		refreshCookie, err := r.Cookie(cookieRefreshToken)
+		if err == nil {
+			refreshToken = refreshCookie.Value
+		}
+	}
+	if refreshToken == "" {
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "absent refresh token"))
+		return
+	}
+
+	sessionID, oldHash, err := auth.ParseRefreshToken(refreshToken)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusUnauthorized, CodeUnauthorized, "invalid refresh token"))
+		return
+	}
+
+	newToken, newHash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed refresh session %s: %v", sessionID, err)
+		writeError(w, r, internalError("authentication error"))
+		return
+	}
+
+	session, status, err := h.storage.RotateSession(
+		r.Context(),
+		sessionID,
+		oldHash,
+		newHash,
+		time.Now().Add(h.tokens.RefreshTTL()),
+	)
+	if err != nil {
+		switch status {
+		case storage.SessionRefreshReused:
+			h.logger.Sugar().Warnf("session %s is revoked: %v", sessionID, err)
+		default:
+			h.logger.Sugar().Errorf("failed refresh session %s: %v", sessionID, err)
+		}
+
+		if status != storage.SessionOperationFailed {
+			clearSessionCookies(w)
+		}
+
+		apiErr := resultAPIError(sessionErrors, status, sessionID)
+		if apiErr == nil {
+			apiErr = resultAPIError(sessionErrors, storage.SessionNotFound, sessionID)
+		}
+		writeError(w, r, apiErr)
+		return
+	}
+
+	tokens, err := h.setSessionTokens(w, session, newToken)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed refresh session %s: %v", sessionID, err)
+		writeError(w, r, internalError("authentication error"))
+		return
+	}
+
+	body, err := json.Marshal(tokens)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshaling tokens of session %s: %v", sessionID, err)
+		writeError(w, r, internalError("authentication error"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// closing the current session
+func (h *HTTPServer) userLogout(w http.ResponseWriter, r *http.Request) {
+	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
+	sessionID := fmt.Sprintf("%v", r.Context().Value(contextSessionID))
+
+	status, err := h.storage.RevokeSession(r.Context(), sessionID, login)
+	if err != nil && status == storage.SessionOperationFailed {
+		h.logger.Sugar().Errorf("failed logout user %s: %v", login, err)
+		writeError(w, r, internalError("user %s is not logged out", login))
+		return
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("User %s is logged out", login)))
+}
+
+// getting a list of active sessions of the user
+func (h *HTTPServer) sessionsGet(w http.ResponseWriter, r *http.Request) {
+	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
+	sessionID := fmt.Sprintf("%v", r.Context().Value(contextSessionID))
+
+	sessions, err := h.storage.GetSessions(r.Context(), login)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed get sessions for %s: %v", login, err)
+		writeError(w, r, internalError("failed get sessions for %s", login))
+		return
+	}
+
+	sessionsBody := make([]*SessionBody, 0, len(sessions))
+	for _, session := range sessions {
+		sessionsBody = append(sessionsBody, &SessionBody{
+			Session: session,
+			Current: session.ID == sessionID,
+		})
+	}
+
+	body, err := json.Marshal(sessionsBody)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshaling sessions for %s: %v", login, err)
+		writeError(w, r, internalError("failed get sessions for %s", login))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// revoking the session of the user
+func (h *HTTPServer) sessionsDelete(w http.ResponseWriter, r *http.Request) {
+	login := fmt.Sprintf("%v", r.Context().Value(contextAuthUser))
+	sessionID := chi.URLParam(r, "id")
+
+	status, err := h.storage.RevokeSession(r.Context(), sessionID, login)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed revoke session %s: %v", sessionID, err)
+		apiErr := resultAPIError(revokeErrors, status, sessionID)
+		if apiErr == nil {
+			apiErr = resultAPIError(revokeErrors, storage.SessionNotFound, sessionID)
+		}
+		writeError(w, r, apiErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Session %s is revoked", sessionID)))
+}
@@ -2,12 +2,11 @@ package gophmarkthttpserver
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"strings"
 
 	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
 )
@@ -15,6 +14,7 @@ import (
 const (
 	cookieAuthToken     = "AuthToken"
 	headerAuthorization = "Authorization"
+	authSchemeBearer    = "Bearer "
 )
 
 type AuthBody struct {
@@ -26,61 +26,36 @@ type AuthBody struct {
 func (h *HTTPServer) userRegistration(w http.ResponseWriter, r *http.Request) {
 	contentType, ok := r.Header["Content-Type"]
 	if !ok || contentType[0] != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("wrong Content-Type. Expect application/json"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidContentType, "wrong Content-Type. Expect application/json"))
 		return
 	}
 
 	defer r.Body.Close()
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed read body"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
 		return
 	}
 
 	var registryData AuthBody
 	err = json.Unmarshal(body, &registryData)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed unmarshal body"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed unmarshal body").withDetails(err.Error()))
 		return
 	}
 
 	status, err := h.storage.AddUser(r.Context(), registryData.Login, registryData.Password)
-	if err != nil {
-		switch status {
-		case storage.UserExist:
-			h.logger.Sugar().Errorf("user %s registration failed: %v", registryData.Login, err)
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(fmt.Sprintf("User %s is already exists", registryData.Login)))
-			return
-		case storage.UserPasswordWrong:
-			h.logger.Sugar().Errorf("user %s registration failed: %v", registryData.Login, err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("Password is unsuitable"))
-			return
-		case storage.UserOperationFailed:
-			h.logger.Sugar().Errorf("user %s registration failed: %v", registryData.Login, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("User %s is not registered", registryData.Login)))
-			return
-		}
+	if apiErr := resultAPIError(registrationErrors, status, registryData.Login); err != nil && apiErr != nil {
+		h.logger.Sugar().Errorf("user %s registration failed: %v", registryData.Login, err)
+		writeError(w, r, apiErr)
+		return
 	}
 
-	authToken := getAuthToken(registryData.Login)
-
-	h.Lock()
-	h.authUsers[authToken] = &authUser{
-		ttl:   authTTL,
-		login: registryData.Login,
+	if err := h.startSession(w, r, registryData.Login); err != nil {
+		h.logger.Sugar().Errorf("user %s authentication failed: %v", registryData.Login, err)
+		writeError(w, r, internalError("authentication error"))
+		return
 	}
-	h.Unlock()
-
-	cookie := http.Cookie{Name: cookieAuthToken, Value: authToken, Expires: time.Now().Add(time.Hour)}
-	http.SetCookie(w, &cookie)
-
-	w.Header().Set(headerAuthorization, authToken)
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fmt.Sprintf("User %s is registered", registryData.Login)))
@@ -90,83 +65,48 @@ func (h *HTTPServer) userRegistration(w http.ResponseWriter, r *http.Request) {
 func (h *HTTPServer) userLogin(w http.ResponseWriter, r *http.Request) {
 	contentType, ok := r.Header["Content-Type"]
 	if !ok || contentType[0] != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("wrong Content-Type. Expect application/json"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidContentType, "wrong Content-Type. Expect application/json"))
 		return
 	}
 
 	defer r.Body.Close()
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed read body"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed read body"))
 		return
 	}
 
 	var authenticationData AuthBody
 	err = json.Unmarshal(body, &authenticationData)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed unmarshal body"))
+		writeError(w, r, newAPIError(http.StatusBadRequest, CodeInvalidBody, "failed unmarshal body").withDetails(err.Error()))
 		return
 	}
 
 	status, err := h.storage.CheckUser(r.Context(), authenticationData.Login, authenticationData.Password)
-	if err != nil {
-		switch status {
-		case storage.UserNotFound:
-			h.logger.Sugar().Errorf("user %s authentication failed: %v", authenticationData.Login, err)
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(fmt.Sprintf("User %s is not found", authenticationData.Login)))
-			return
-		case storage.UserPasswordWrong:
-			h.logger.Sugar().Errorf("user %s authentication failed: %v", authenticationData.Login, err)
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Incorrect password"))
-			return
-		case storage.UserOperationFailed:
-			h.logger.Sugar().Errorf("user %s authentication failed: %v", authenticationData.Login, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Authentication error"))
-			return
-		}
+	if apiErr := resultAPIError(loginErrors, status, authenticationData.Login); err != nil && apiErr != nil {
+		h.logger.Sugar().Errorf("user %s authentication failed: %v", authenticationData.Login, err)
+		writeError(w, r, apiErr)
+		return
 	}
 
-	authToken := getAuthToken(authenticationData.Login)
-
-	h.Lock()
-	h.authUsers[authToken] = &authUser{
-		ttl:   authTTL,
-		login: authenticationData.Login,
+	if err := h.startSession(w, r, authenticationData.Login); err != nil {
+		h.logger.Sugar().Errorf("user %s authentication failed: %v", authenticationData.Login, err)
+		writeError(w, r, internalError("authentication error"))
+		return
 	}
-	h.Unlock()
-
-	cookie := http.Cookie{Name: cookieAuthToken, Value: authToken, Expires: time.Now().Add(time.Hour)}
-	http.SetCookie(w, &cookie)
 
-	w.Header().Set(headerAuthorization, authToken)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fmt.Sprintf("User %s is authenticated", authenticationData.Login)))
 }
 
-// generate authentication token
-func getAuthToken(login string) string {
-	buf := []byte(login)
-	salt, err := time.Now().MarshalBinary()
-	if err == nil {
-		buf = append(buf, salt...)
-	}
-
-	return fmt.Sprintf("%x", sha256.Sum256(buf))
-}
-
-// checking authentication token
+// checking authentication token and its session
 func (h *HTTPServer) authUserCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var token string
-		authorization, ok := r.Header[headerAuthorization]
-		if ok {
-			token = authorization[0]
+		authorization := r.Header.Get(headerAuthorization)
+		if authorization != "" {
+			token = strings.TrimPrefix(authorization, authSchemeBearer)
 		} else {
 			tokenCookie, err := r.Cookie(cookieAuthToken)
 			if err == nil {
@@ -174,22 +114,35 @@ func (h *HTTPServer) authUserCtx(next http.Handler) http.Handler {
 			}
 		}
 		if token == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("absent auth token"))
+			writeError(w, r, newAPIError(http.StatusUnauthorized, CodeUnauthorized, "absent auth token"))
+			return
+		}
+
+		claims, err := h.tokens.Verify(token)
+		if err != nil {
+			h.logger.Sugar().Debugf("auth token rejected: %v", err)
+			writeError(w, r, newAPIError(http.StatusUnauthorized, CodeUnauthorized, "invalid token"))
 			return
 		}
 
-		h.RLock()
-		defer h.RUnlock()
-		user, ok := h.authUsers[token]
-		if !ok {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("invalid token"))
+		status, err := h.storage.CheckSession(r.Context(), claims.SessionID, claims.Login)
+		if err != nil {
+			if status == storage.SessionOperationFailed {
+				h.logger.Sugar().Errorf("failed check session of %s: %v", claims.Login, err)
+			} else {
+				h.logger.Sugar().Debugf("auth session rejected: %v", err)
+			}
+
+			apiErr := resultAPIError(sessionErrors, status, claims.SessionID)
+			if apiErr == nil {
+				apiErr = resultAPIError(sessionErrors, storage.SessionNotFound, claims.SessionID)
+			}
+			writeError(w, r, apiErr)
 			return
 		}
-		user.ttl = authTTL
 
-		ctx := context.WithValue(r.Context(), contextAuthUser, user.login)
+		ctx := context.WithValue(r.Context(), contextAuthUser, claims.Login)
+		ctx = context.WithValue(ctx, contextSessionID, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,76 @@
+package gophmarktledger
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const reconcileInterval = 60 * time.Minute
+
+// Reconciler periodically checks that the materialised balances match the ledger.
+type Reconciler struct {
+	storage  storage.Storage
+	logger   *zap.Logger
+	interval time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewReconciler(storage storage.Storage, logger *zap.Logger) *Reconciler {
+	return &Reconciler{
+		storage:  storage,
+		logger:   logger,
+		interval: reconcileInterval,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (r *Reconciler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.Reconcile(ctx)
+	for {
+		select {
+		case <-r.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.Reconcile(ctx)
+		}
+	}
+}
+
+func (r *Reconciler) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	return nil
+}
+
+// Reconcile logs every balance that differs from the sum of its ledger entries.
+func (r *Reconciler) Reconcile(ctx context.Context) int {
+	mismatches, err := r.storage.Reconcile(ctx)
+	if err != nil {
+		r.logger.Sugar().Errorf("failed reconcile balances: %v", err)
+		return 0
+	}
+
+	for _, mismatch := range mismatches {
+		r.logger.Error(
+			"balance does not match ledger",
+			zap.String("login", mismatch.Login),
+			zap.Stringer("current", mismatch.Current),
+			zap.Stringer("ledger_current", mismatch.LedgerCurrent),
+			zap.Stringer("withdrawn", mismatch.Withdrawn),
+			zap.Stringer("ledger_withdrawn", mismatch.LedgerWithdrawn),
+		)
+	}
+
+	return len(mismatches)
+}
@@ -0,0 +1,114 @@
+package gophmarktmetrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+// storageScrapeTimeout limits the storage queries of one scrape.
+const storageScrapeTimeout = 5 * time.Second
+
+// accrualCollector reads the counters kept by the accrual service.
+type accrualCollector struct {
+	stats  *accrual.Stats
+	polls  *prometheus.Desc
+	checks *prometheus.Desc
+}
+
+func newAccrualCollector(stats *accrual.Stats) *accrualCollector {
+	return &accrualCollector{
+		stats: stats,
+		polls: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "accrual", "polls_total"),
+			"Number of the requests to the accrual system by response class.",
+			[]string{"class"}, nil,
+		),
+		checks: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "accrual", "checks_total"),
+			"Number of the order checks by outcome.",
+			[]string{"outcome"}, nil,
+		),
+	}
+}
+
+func (c *accrualCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.polls
+	ch <- c.checks
+}
+
+func (c *accrualCollector) Collect(ch chan<- prometheus.Metric) {
+	for class, count := range c.stats.Responses() {
+		ch <- prometheus.MustNewConstMetric(c.polls, prometheus.CounterValue, float64(count), string(class))
+	}
+
+	for outcome, count := range c.stats.Snapshot() {
+		ch <- prometheus.MustNewConstMetric(c.checks, prometheus.CounterValue, float64(count), string(outcome))
+	}
+}
+
+// storageCollector queries the state of the orders and the ledger.
+type storageCollector struct {
+	storage   storage.Storage
+	logger    *zap.Logger
+	pending   *prometheus.Desc
+	accrued   *prometheus.Desc
+	withdrawn *prometheus.Desc
+}
+
+func newStorageCollector(appStorage storage.Storage, logger *zap.Logger) *storageCollector {
+	return &storageCollector{
+		storage: appStorage,
+		logger:  logger,
+		pending: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "orders", "pending"),
+			"Number of the orders waiting for the accrual.",
+			nil, nil,
+		),
+		accrued: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "points", "accrued"),
+			"Sum of the points accrued to all users.",
+			nil, nil,
+		),
+		withdrawn: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "points", "withdrawn"),
+			"Sum of the points withdrawn by all users.",
+			nil, nil,
+		),
+	}
+}
+
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pending
+	ch <- c.accrued
+	ch <- c.withdrawn
+}
+
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageScrapeTimeout)
+	defer cancel()
+
+	pending, err := c.storage.CountUnprocessedOrders(ctx)
+	if err != nil {
+		c.logger.Sugar().Errorf("failed collect pending orders: %v", err)
+		ch <- prometheus.NewInvalidMetric(c.pending, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(pending))
+	}
+
+	totals, err := c.storage.GetLedgerTotals(ctx)
+	if err != nil {
+		c.logger.Sugar().Errorf("failed collect points totals: %v", err)
+		ch <- prometheus.NewInvalidMetric(c.accrued, err)
+		ch <- prometheus.NewInvalidMetric(c.withdrawn, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.accrued, prometheus.GaugeValue, totals.Accrued.Float64())
+	ch <- prometheus.MustNewConstMetric(c.withdrawn, prometheus.GaugeValue, totals.Withdrawn.Float64())
+}
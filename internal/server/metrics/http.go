@@ -0,0 +1,37 @@
+package gophmarktmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// unknownRoute labels the requests matched by no route.
+const unknownRoute = "unknown"
+
+// HTTP is the middleware counting the requests by the chi route pattern, not the raw path.
+func (m *Metrics) HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := unknownRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		code := strconv.Itoa(status)
+		m.httpRequests.WithLabelValues(r.Method, route, code).Inc()
+		m.httpDuration.WithLabelValues(r.Method, route, code).Observe(time.Since(start).Seconds())
+	})
+}
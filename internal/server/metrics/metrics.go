@@ -0,0 +1,93 @@
+// Package gophmarktmetrics exposes the Prometheus metrics of the gophermart service.
+package gophmarktmetrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	accrual "github.com/zvfkjytytw/gophmarkt/internal/server/accrual"
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+const namespace = "gophmarkt"
+
+// Metrics is the registry of all the service metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+	logger   *zap.Logger
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+}
+
+func New(logger *zap.Logger) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		logger:   logger,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of the HTTP requests by route pattern and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the HTTP requests by route pattern and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of the storage operations by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "errors_total",
+			Help:      "Number of the storage operations failed in the backend by method, the business results are not counted.",
+		}, []string{"method"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.storageDuration,
+		m.storageErrors,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exposes the statistics of the connection pool.
+func (m *Metrics) RegisterDB(db *sql.DB) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// RegisterAccrual exposes the counters of the accrual polls and order checks.
+func (m *Metrics) RegisterAccrual(stats *accrual.Stats) error {
+	return m.registry.Register(newAccrualCollector(stats))
+}
+
+// RegisterStorage exposes the pending orders and the points totals read from the storage on every scrape.
+func (m *Metrics) RegisterStorage(appStorage storage.Storage) error {
+	return m.registry.Register(newStorageCollector(appStorage, m.logger))
+}
@@ -0,0 +1,252 @@
+package gophmarktmetrics
+
+import (
+	"context"
+	"time"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+// instrumentedStorage measures every operation of the wrapped storage.
+type instrumentedStorage struct {
+	storage storage.Storage
+	metrics *Metrics
+}
+
+// Storage wraps the storage with the latency and error metrics of its methods.
+func (m *Metrics) Storage(appStorage storage.Storage) storage.Storage {
+	return &instrumentedStorage{
+		storage: appStorage,
+		metrics: m,
+	}
+}
+
+// observe counts the failures of the backend only, the expected business results are not errors.
+func (s *instrumentedStorage) observe(method string, start time.Time, failed bool) {
+	s.metrics.storageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if failed {
+		s.metrics.storageErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (s *instrumentedStorage) AddUser(ctx context.Context, login, password string) (storage.UserOperationResult, error) {
+	start := time.Now()
+	result, err := s.storage.AddUser(ctx, login, password)
+	s.observe("AddUser", start, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *instrumentedStorage) CheckUser(ctx context.Context, login, password string) (storage.UserOperationResult, error) {
+	start := time.Now()
+	result, err := s.storage.CheckUser(ctx, login, password)
+	s.observe("CheckUser", start, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *instrumentedStorage) AddOrder(ctx context.Context, oid, login string) (storage.OrderOperationResult, error) {
+	start := time.Now()
+	result, err := s.storage.AddOrder(ctx, oid, login)
+	s.observe("AddOrder", start, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *instrumentedStorage) AddOrders(ctx context.Context, oids []string, login string) ([]storage.OrderOperationResult, error) {
+	start := time.Now()
+	result, err := s.storage.AddOrders(ctx, oids, login)
+	s.observe("AddOrders", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) GetOrders(ctx context.Context, login string, filter *storage.ListFilter) ([]*storage.Order, string, error) {
+	start := time.Now()
+	first, second, err := s.storage.GetOrders(ctx, login, filter)
+	s.observe("GetOrders", start, storage.IsFailure(err))
+
+	return first, second, err
+}
+
+func (s *instrumentedStorage) GetOrder(ctx context.Context, oid, login string) (*storage.Order, error) {
+	start := time.Now()
+	result, err := s.storage.GetOrder(ctx, oid, login)
+	s.observe("GetOrder", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) GetUnprocessedOrders(ctx context.Context) ([]*storage.Order, error) {
+	start := time.Now()
+	result, err := s.storage.GetUnprocessedOrders(ctx)
+	s.observe("GetUnprocessedOrders", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) CountUnprocessedOrders(ctx context.Context) (int, error) {
+	start := time.Now()
+	result, err := s.storage.CountUnprocessedOrders(ctx)
+	s.observe("CountUnprocessedOrders", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) UpdateOrder(ctx context.Context, order *storage.Order, source storage.OrderEventSource) error {
+	start := time.Now()
+	err := s.storage.UpdateOrder(ctx, order, source)
+	s.observe("UpdateOrder", start, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *instrumentedStorage) GetOrderEvents(ctx context.Context, oid, login string) ([]*storage.OrderEvent, error) {
+	start := time.Now()
+	result, err := s.storage.GetOrderEvents(ctx, oid, login)
+	s.observe("GetOrderEvents", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) ClaimOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]*storage.OrderCheck, error) {
+	start := time.Now()
+	result, err := s.storage.ClaimOrders(ctx, owner, limit, lease)
+	s.observe("ClaimOrders", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) ScheduleOrderCheck(ctx context.Context, oid, owner string, attempts, notRegistered int, next time.Time) error {
+	start := time.Now()
+	err := s.storage.ScheduleOrderCheck(ctx, oid, owner, attempts, notRegistered, next)
+	s.observe("ScheduleOrderCheck", start, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *instrumentedStorage) AddDrawal(ctx context.Context, oid, login string, count storage.Points) (storage.DrawalOperationResult, error) {
+	start := time.Now()
+	result, err := s.storage.AddDrawal(ctx, oid, login, count)
+	s.observe("AddDrawal", start, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *instrumentedStorage) GetDrawals(ctx context.Context, login string, filter *storage.ListFilter) ([]*storage.Drawal, string, error) {
+	start := time.Now()
+	first, second, err := s.storage.GetDrawals(ctx, login, filter)
+	s.observe("GetDrawals", start, storage.IsFailure(err))
+
+	return first, second, err
+}
+
+func (s *instrumentedStorage) GetBalance(ctx context.Context, login string) (*storage.Balance, error) {
+	start := time.Now()
+	result, err := s.storage.GetBalance(ctx, login)
+	s.observe("GetBalance", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) AddBalance(ctx context.Context, login string, count storage.Points) error {
+	start := time.Now()
+	err := s.storage.AddBalance(ctx, login, count)
+	s.observe("AddBalance", start, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *instrumentedStorage) DrawnBalance(ctx context.Context, login string, count storage.Points) error {
+	start := time.Now()
+	err := s.storage.DrawnBalance(ctx, login, count)
+	s.observe("DrawnBalance", start, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *instrumentedStorage) DropBalance(ctx context.Context, login string) error {
+	start := time.Now()
+	err := s.storage.DropBalance(ctx, login)
+	s.observe("DropBalance", start, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *instrumentedStorage) GetLedger(ctx context.Context, login string, limit, offset int) ([]*storage.LedgerEntry, error) {
+	start := time.Now()
+	result, err := s.storage.GetLedger(ctx, login, limit, offset)
+	s.observe("GetLedger", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) ReverseTransaction(ctx context.Context, txID string) error {
+	start := time.Now()
+	err := s.storage.ReverseTransaction(ctx, txID)
+	s.observe("ReverseTransaction", start, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *instrumentedStorage) Reconcile(ctx context.Context) ([]*storage.BalanceMismatch, error) {
+	start := time.Now()
+	result, err := s.storage.Reconcile(ctx)
+	s.observe("Reconcile", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) GetLedgerTotals(ctx context.Context) (*storage.LedgerTotals, error) {
+	start := time.Now()
+	result, err := s.storage.GetLedgerTotals(ctx)
+	s.observe("GetLedgerTotals", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) AddSession(ctx context.Context, session *storage.Session, refreshHash string) error {
+	start := time.Now()
+	err := s.storage.AddSession(ctx, session, refreshHash)
+	s.observe("AddSession", start, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *instrumentedStorage) RotateSession(ctx context.Context, sid, oldHash, newHash string, expiresAt time.Time) (*storage.Session, storage.SessionOperationResult, error) {
+	start := time.Now()
+	first, second, err := s.storage.RotateSession(ctx, sid, oldHash, newHash, expiresAt)
+	s.observe("RotateSession", start, err != nil && second.Failed())
+
+	return first, second, err
+}
+
+func (s *instrumentedStorage) CheckSession(ctx context.Context, sid, login string) (storage.SessionOperationResult, error) {
+	start := time.Now()
+	result, err := s.storage.CheckSession(ctx, sid, login)
+	s.observe("CheckSession", start, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *instrumentedStorage) GetSessions(ctx context.Context, login string) ([]*storage.Session, error) {
+	start := time.Now()
+	result, err := s.storage.GetSessions(ctx, login)
+	s.observe("GetSessions", start, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *instrumentedStorage) RevokeSession(ctx context.Context, sid, login string) (storage.SessionOperationResult, error) {
+	start := time.Now()
+	result, err := s.storage.RevokeSession(ctx, sid, login)
+	s.observe("RevokeSession", start, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *instrumentedStorage) Close() error {
+	return s.storage.Close()
+}
+
+var _ storage.Storage = (*instrumentedStorage)(nil)
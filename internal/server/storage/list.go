@@ -0,0 +1,188 @@
+package gophmarktstorage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type SortOrder string
+
+const (
+	SortDesc SortOrder = "desc"
+	SortAsc  SortOrder = "asc"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListFilter narrows and pages the lists of orders and withdrawals.
+// The lists are ordered by the date and the order number, the newest first by default.
+type ListFilter struct {
+	// page size, 0 returns the whole list
+	Limit int
+	// position after the last item of the previous page
+	Cursor *Cursor
+	// order statuses, empty means any status
+	Statuses []OrderStatus
+	// date range, From is inclusive, To is exclusive, zero means unbounded
+	From time.Time
+	To   time.Time
+	Sort SortOrder
+}
+
+// Cursor is the sort key of the last item of the page.
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// Encode returns the opaque form of the cursor for the clients.
+func (c *Cursor) Encode() string {
+	raw := strconv.FormatInt(c.Time.UnixMicro(), 10) + ":" + c.ID
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	micro, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	usec, err := strconv.ParseInt(micro, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Time: time.UnixMicro(usec).UTC(), ID: id}, nil
+}
+
+func (f *ListFilter) asc() bool {
+	return f != nil && f.Sort == SortAsc
+}
+
+// applyListFilter adds the conditions, the keyset and the order of the filter to the query.
+// One row over the limit is requested to know whether the next page exists.
+func applyListFilter(query sq.SelectBuilder, filter *ListFilter, timeColumn, idColumn string) sq.SelectBuilder {
+	direction, compare := "DESC", "<"
+	if filter.asc() {
+		direction, compare = "ASC", ">"
+	}
+
+	if filter != nil {
+		if len(filter.Statuses) > 0 {
+			query = query.Where(sq.Eq{"status": filter.Statuses})
+		}
+
+		if !filter.From.IsZero() {
+			query = query.Where(sq.GtOrEq{timeColumn: filter.From})
+		}
+
+		if !filter.To.IsZero() {
+			query = query.Where(sq.Lt{timeColumn: filter.To})
+		}
+
+		if filter.Cursor != nil {
+			query = query.Where(
+				fmt.Sprintf("(%s, %s) %s (?, ?)", timeColumn, idColumn, compare),
+				filter.Cursor.Time, filter.Cursor.ID,
+			)
+		}
+
+		if filter.Limit > 0 {
+			query = query.Limit(uint64(filter.Limit) + 1)
+		}
+	}
+
+	return query.OrderBy(timeColumn+" "+direction, idColumn+" "+direction)
+}
+
+// listItem is the sort key of an item kept in memory.
+type listItem struct {
+	time   time.Time
+	id     string
+	status OrderStatus
+}
+
+// matches checks the item against the conditions and the keyset of the filter.
+func (f *ListFilter) matches(item listItem) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			found = found || status == item.status
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if !f.From.IsZero() && item.time.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && !item.time.Before(f.To) {
+		return false
+	}
+
+	if f.Cursor != nil {
+		cursor := listItem{time: f.Cursor.Time, id: f.Cursor.ID}
+		if f.asc() {
+			return itemLess(cursor, item)
+		}
+
+		return itemLess(item, cursor)
+	}
+
+	return true
+}
+
+func itemLess(a, b listItem) bool {
+	if !a.time.Equal(b.time) {
+		return a.time.Before(b.time)
+	}
+
+	return a.id < b.id
+}
+
+// sortItems orders the indexes of the items as the filter requires.
+func sortItems(items []listItem, filter *ListFilter) []int {
+	indexes := make([]int, len(items))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		if filter.asc() {
+			return itemLess(items[indexes[i]], items[indexes[j]])
+		}
+
+		return itemLess(items[indexes[j]], items[indexes[i]])
+	})
+
+	return indexes
+}
+
+// nextPage cuts the extra row and returns the cursor of the next page, empty on the last page.
+func nextPage(count int, filter *ListFilter, last func(i int) *Cursor) (int, string) {
+	if filter == nil || filter.Limit <= 0 || count <= filter.Limit {
+		return count, ""
+	}
+
+	return filter.Limit, last(filter.Limit - 1).Encode()
+}
@@ -0,0 +1,76 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *MemStorage) AddBalance(ctx context.Context, login string, count Points) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.postMovement(&ledgerMovement{
+		kind:      LedgerAdjustment,
+		login:     login,
+		amount:    count,
+		createdAt: time.Now(),
+	})
+}
+
+func (s *MemStorage) DrawnBalance(ctx context.Context, login string, count Points) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.balances[login]; !ok {
+		return fmt.Errorf("no balance for login %s", login)
+	}
+
+	return s.postMovement(&ledgerMovement{
+		kind:      LedgerWithdrawal,
+		login:     login,
+		amount:    -count,
+		createdAt: time.Now(),
+	})
+}
+
+func (s *MemStorage) GetBalance(ctx context.Context, login string) (*Balance, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	balance, ok := s.balances[login]
+	if !ok {
+		return nil, fmt.Errorf("no balance for login %s", login)
+	}
+
+	return &Balance{
+		Current:   balance.Current,
+		Withdrawn: balance.Withdrawn,
+	}, nil
+}
+
+func (s *MemStorage) DropBalance(ctx context.Context, login string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	balance, ok := s.balances[login]
+	if !ok {
+		return nil
+	}
+
+	if balance.Current != 0 {
+		_, err := s.insertMovement(&ledgerMovement{
+			kind:      LedgerAdjustment,
+			login:     login,
+			amount:    -balance.Current,
+			createdAt: time.Now(),
+		}, accountAdjustment)
+		if err != nil {
+			return err
+		}
+	}
+
+	delete(s.balances, login)
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type memLedgerEntry struct {
+	entry   LedgerEntry
+	account string
+	login   string
+}
+
+// insertMovement writes both postings of the movement, the caller holds the lock.
+// An already posted movement id is skipped and reported by false.
+func (s *MemStorage) insertMovement(movement *ledgerMovement, counterAccount string) (bool, error) {
+	if movement.txID == "" {
+		txID, err := newLedgerTxID()
+		if err != nil {
+			return false, err
+		}
+		movement.txID = txID
+	}
+
+	if s.ledgerTxs[movement.txID] {
+		return false, nil
+	}
+	s.ledgerTxs[movement.txID] = true
+
+	for _, posting := range []struct {
+		account string
+		login   string
+		amount  Points
+	}{
+		{account: userAccount(movement.login), login: movement.login, amount: movement.amount},
+		{account: counterAccount, amount: -movement.amount},
+	} {
+		s.ledgerSeq++
+		s.ledger = append(s.ledger, &memLedgerEntry{
+			entry: LedgerEntry{
+				ID:         s.ledgerSeq,
+				TxID:       movement.txID,
+				Kind:       movement.kind,
+				Amount:     posting.amount,
+				Order:      movement.order,
+				ReversalOf: movement.reversalOf,
+				CreatedAt:  movement.createdAt,
+			},
+			account: posting.account,
+			login:   posting.login,
+		})
+	}
+
+	return true, nil
+}
+
+// postMovement records the movement and applies it to the balance, the caller holds the lock.
+func (s *MemStorage) postMovement(movement *ledgerMovement) error {
+	balance, ok := s.balances[movement.login]
+	if !ok {
+		balance = &Balance{}
+	}
+
+	if balance.Current+movement.amount < 0 {
+		return fmt.Errorf("not enough points on balance for login %s", movement.login)
+	}
+
+	inserted, err := s.insertMovement(movement, counterAccounts[movement.kind])
+	if err != nil {
+		return err
+	}
+
+	if !inserted {
+		return fmt.Errorf("ledger transaction %s is already posted", movement.txID)
+	}
+
+	balance.Current += movement.amount
+	if movement.kind == LedgerWithdrawal {
+		balance.Withdrawn -= movement.amount
+	}
+	s.balances[movement.login] = balance
+
+	return nil
+}
+
+// creditAccrual posts the accrual of the order once, the caller holds the lock.
+func (s *MemStorage) creditAccrual(login, oid string, accrual Points) error {
+	if s.ledgerTxs[accrualTxID(oid)] {
+		return nil
+	}
+
+	return s.postMovement(&ledgerMovement{
+		txID:      accrualTxID(oid),
+		kind:      LedgerAccrual,
+		login:     login,
+		amount:    accrual,
+		order:     oid,
+		createdAt: time.Now(),
+	})
+}
+
+func (s *MemStorage) GetLedger(ctx context.Context, login string, limit, offset int) ([]*LedgerEntry, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	account := userAccount(login)
+	entries := make([]*LedgerEntry, 0)
+	for i := len(s.ledger) - 1; i >= 0 && len(entries) < limit; i-- {
+		if s.ledger[i].account != account {
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		entry := s.ledger[i].entry
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+func (s *MemStorage) ReverseTransaction(ctx context.Context, txID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var original *memLedgerEntry
+	for _, entry := range s.ledger {
+		if entry.entry.ReversalOf == txID {
+			return fmt.Errorf("ledger transaction %s is already reversed", txID)
+		}
+
+		if entry.entry.TxID == txID && entry.login != "" {
+			original = entry
+		}
+	}
+
+	if original == nil {
+		return fmt.Errorf("ledger transaction %s not found", txID)
+	}
+
+	if original.entry.Kind == LedgerReversal {
+		return fmt.Errorf("ledger transaction %s is a reversal itself", txID)
+	}
+
+	balance, ok := s.balances[original.login]
+	if !ok {
+		balance = &Balance{}
+	}
+
+	amount := -original.entry.Amount
+	if balance.Current+amount < 0 {
+		return fmt.Errorf("not enough points on balance for login %s to reverse %s", original.login, txID)
+	}
+
+	_, err := s.insertMovement(&ledgerMovement{
+		kind:       LedgerReversal,
+		login:      original.login,
+		amount:     amount,
+		order:      original.entry.Order,
+		reversalOf: txID,
+		createdAt:  time.Now(),
+	}, counterAccounts[original.entry.Kind])
+	if err != nil {
+		return err
+	}
+
+	balance.Current += amount
+	if original.entry.Kind == LedgerWithdrawal {
+		balance.Withdrawn += original.entry.Amount
+	}
+	s.balances[original.login] = balance
+
+	return nil
+}
+
+func (s *MemStorage) Reconcile(ctx context.Context) ([]*BalanceMismatch, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	kinds := make(map[string]LedgerEntryKind)
+	for _, entry := range s.ledger {
+		kinds[entry.entry.TxID] = entry.entry.Kind
+	}
+
+	currents := make(map[string]Points)
+	withdrawns := make(map[string]Points)
+	for _, entry := range s.ledger {
+		if entry.login == "" {
+			continue
+		}
+
+		currents[entry.login] += entry.entry.Amount
+		if entry.entry.Kind == LedgerWithdrawal || kinds[entry.entry.ReversalOf] == LedgerWithdrawal {
+			withdrawns[entry.login] -= entry.entry.Amount
+		}
+	}
+
+	mismatches := make([]*BalanceMismatch, 0)
+	for login, balance := range s.balances {
+		if balance.Current == currents[login] && balance.Withdrawn == withdrawns[login] {
+			continue
+		}
+
+		mismatches = append(mismatches, &BalanceMismatch{
+			Login:           login,
+			Current:         balance.Current,
+			Withdrawn:       balance.Withdrawn,
+			LedgerCurrent:   currents[login],
+			LedgerWithdrawn: withdrawns[login],
+		})
+	}
+
+	return mismatches, nil
+}
+
+func (s *MemStorage) GetLedgerTotals(ctx context.Context) (*LedgerTotals, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	totals := &LedgerTotals{}
+	for _, entry := range s.ledger {
+		if entry.login == "" {
+			continue
+		}
+
+		switch entry.entry.Kind {
+		case LedgerAccrual:
+			totals.Accrued += entry.entry.Amount
+		case LedgerWithdrawal:
+			totals.Withdrawn -= entry.entry.Amount
+		}
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,66 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (s *MemStorage) ClaimOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]*OrderCheck, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	due := make([]*memOrder, 0)
+	for _, o := range s.orderList {
+		if o.order.Status != OrderStatusNew && o.order.Status != OrderStatusProcessing {
+			continue
+		}
+
+		if o.nextCheckAt.After(now) || o.leaseUntil.After(now) {
+			continue
+		}
+
+		due = append(due, o)
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].nextCheckAt.Before(due[j].nextCheckAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	checks := make([]*OrderCheck, 0, len(due))
+	for _, o := range due {
+		o.leaseOwner = owner
+		o.leaseUntil = now.Add(lease)
+		checks = append(checks, &OrderCheck{
+			Number:        o.order.Number,
+			Status:        o.order.Status,
+			Attempts:      o.checkAttempts,
+			NotRegistered: o.notRegistered,
+		})
+	}
+
+	return checks, nil
+}
+
+func (s *MemStorage) ScheduleOrderCheck(ctx context.Context, oid, owner string, attempts, notRegistered int, next time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	o, ok := s.orders[oid]
+	if !ok || o.leaseOwner != owner {
+		return fmt.Errorf("lease of order %s is lost by %s", oid, owner)
+	}
+
+	o.nextCheckAt = next
+	o.checkAttempts = attempts
+	o.notRegistered = notRegistered
+	o.leaseOwner = ""
+	o.leaseUntil = time.Time{}
+
+	return nil
+}
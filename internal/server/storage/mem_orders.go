@@ -0,0 +1,218 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *MemStorage) AddOrder(ctx context.Context, oid, login string) (OrderOperationResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if order, ok := s.orders[oid]; ok {
+		if order.login == login {
+			return OrderAddBefore, errors.New("order already upload")
+		}
+
+		return OrderAddByOther, errors.New("order upload by other")
+	}
+
+	now := time.Now().Truncate(time.Second)
+	order := &memOrder{
+		order: Order{
+			Number:     oid,
+			Status:     OrderStatusNew,
+			UploadedAt: now,
+		},
+		login:       login,
+		updatedAt:   now,
+		nextCheckAt: now,
+		events:      []*OrderEvent{{To: OrderStatusNew, Source: EventSourceUser, CreatedAt: now}},
+	}
+	s.orders[oid] = order
+	s.orderList = append(s.orderList, order)
+
+	return OrderAddSuccess, nil
+}
+
+func (s *MemStorage) AddOrders(ctx context.Context, oids []string, login string) ([]OrderOperationResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	results := make([]OrderOperationResult, len(oids))
+
+	now := time.Now().Truncate(time.Second)
+	added := make(map[string]bool)
+	for i, oid := range oids {
+		if added[oid] {
+			results[i] = OrderAddBefore
+			continue
+		}
+
+		if order, ok := s.orders[oid]; ok {
+			results[i] = OrderAddByOther
+			if order.login == login {
+				results[i] = OrderAddBefore
+			}
+			continue
+		}
+
+		order := &memOrder{
+			order: Order{
+				Number:     oid,
+				Status:     OrderStatusNew,
+				UploadedAt: now,
+			},
+			login:       login,
+			updatedAt:   now,
+			nextCheckAt: now,
+			events:      []*OrderEvent{{To: OrderStatusNew, Source: EventSourceUser, CreatedAt: now}},
+		}
+		s.orders[oid] = order
+		s.orderList = append(s.orderList, order)
+		added[oid] = true
+		results[i] = OrderAddSuccess
+	}
+
+	return results, nil
+}
+
+func (s *MemStorage) GetOrders(ctx context.Context, login string, filter *ListFilter) ([]*Order, string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	items := make([]listItem, len(s.orderList))
+	for i, o := range s.orderList {
+		items[i] = listItem{time: o.order.UploadedAt, id: o.order.Number, status: o.order.Status}
+	}
+
+	orders := make([]*Order, 0)
+	for _, i := range sortItems(items, filter) {
+		o := s.orderList[i]
+		if o.login != login || !filter.matches(items[i]) {
+			continue
+		}
+
+		order := o.order
+		orders = append(orders, &order)
+		if filter != nil && filter.Limit > 0 && len(orders) > filter.Limit {
+			break
+		}
+	}
+
+	count, next := nextPage(len(orders), filter, func(i int) *Cursor {
+		return &Cursor{Time: orders[i].UploadedAt, ID: orders[i].Number}
+	})
+
+	return orders[:count], next, nil
+}
+
+func (s *MemStorage) GetOrder(ctx context.Context, oid, login string) (*Order, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	o, ok := s.orders[oid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, oid)
+	}
+
+	if o.login != login {
+		return nil, fmt.Errorf("%w: %s", ErrOrderForeign, oid)
+	}
+
+	order := o.order
+	order.UpdatedAt = o.updatedAt
+
+	return &order, nil
+}
+
+func (s *MemStorage) GetUnprocessedOrders(ctx context.Context) ([]*Order, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	orders := make([]*Order, 0)
+	for _, o := range s.orderList {
+		if o.order.Status != OrderStatusNew && o.order.Status != OrderStatusProcessing {
+			continue
+		}
+
+		orders = append(orders, &Order{
+			Number: o.order.Number,
+			Status: o.order.Status,
+		})
+	}
+
+	return orders, nil
+}
+
+func (s *MemStorage) CountUnprocessedOrders(ctx context.Context) (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	count := 0
+	for _, o := range s.orderList {
+		if o.order.Status == OrderStatusNew || o.order.Status == OrderStatusProcessing {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *MemStorage) UpdateOrder(ctx context.Context, order *Order, source OrderEventSource) error {
+	s.Lock()
+	defer s.Unlock()
+
+	o, ok := s.orders[order.Number]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrOrderNotFound, order.Number)
+	}
+
+	if o.order.Status == order.Status {
+		return nil
+	}
+
+	if !o.order.Status.CanTransit(order.Status) {
+		return fmt.Errorf("%w: order %s from %s to %s", ErrOrderTransition, order.Number, o.order.Status, order.Status)
+	}
+
+	if order.Status == OrderStatusProcessed {
+		if _, ok := s.balances[o.login]; !ok {
+			return fmt.Errorf("balance for login %s not found", o.login)
+		}
+
+		if order.Accrual > 0 {
+			err := s.creditAccrual(o.login, order.Number, order.Accrual)
+			if err != nil {
+				return fmt.Errorf("failed credit accrual of order %s to login %s: %v", order.Number, o.login, err)
+			}
+		}
+		o.order.Accrual = order.Accrual
+	}
+
+	o.events = append(o.events, &OrderEvent{From: o.order.Status, To: order.Status, Source: source, CreatedAt: time.Now()})
+	o.order.Status = order.Status
+	o.updatedAt = order.UploadedAt
+
+	return nil
+}
+
+func (s *MemStorage) GetOrderEvents(ctx context.Context, oid, login string) ([]*OrderEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	o, ok := s.orders[oid]
+	if !ok || o.login != login {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, oid)
+	}
+
+	events := make([]*OrderEvent, 0, len(o.events))
+	for _, e := range o.events {
+		event := *e
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,118 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type memSession struct {
+	session     Session
+	refreshHash string
+	revoked     bool
+}
+
+func (s *MemStorage) AddSession(ctx context.Context, session *Session, refreshHash string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		return fmt.Errorf("session %s already exists", session.ID)
+	}
+
+	s.sessions[session.ID] = &memSession{
+		session:     *session,
+		refreshHash: refreshHash,
+	}
+
+	return nil
+}
+
+func (s *MemStorage) RotateSession(ctx context.Context, sid, oldHash, newHash string, expiresAt time.Time) (*Session, SessionOperationResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	session, ok := s.sessions[sid]
+	if !ok {
+		return nil, SessionNotFound, fmt.Errorf("session %s not found", sid)
+	}
+
+	now := time.Now()
+	if session.revoked {
+		return nil, SessionRevoked, fmt.Errorf("session %s is revoked", sid)
+	}
+
+	if session.session.ExpiresAt.Before(now) {
+		return nil, SessionExpired, fmt.Errorf("session %s is expired", sid)
+	}
+
+	if session.refreshHash != oldHash {
+		session.revoked = true
+		return nil, SessionRefreshReused, fmt.Errorf("refresh token of session %s is reused", sid)
+	}
+
+	session.refreshHash = newHash
+	session.session.LastUsedAt = now
+	session.session.ExpiresAt = expiresAt
+
+	result := session.session
+
+	return &result, SessionSuccess, nil
+}
+
+func (s *MemStorage) CheckSession(ctx context.Context, sid, login string) (SessionOperationResult, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	session, ok := s.sessions[sid]
+	if !ok || session.session.Login != login {
+		return SessionNotFound, fmt.Errorf("session %s not found", sid)
+	}
+
+	if session.revoked {
+		return SessionRevoked, fmt.Errorf("session %s is revoked", sid)
+	}
+
+	if session.session.ExpiresAt.Before(time.Now()) {
+		return SessionExpired, fmt.Errorf("session %s is expired", sid)
+	}
+
+	return SessionSuccess, nil
+}
+
+func (s *MemStorage) GetSessions(ctx context.Context, login string) ([]*Session, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now()
+	sessions := make([]*Session, 0)
+	for _, session := range s.sessions {
+		if session.session.Login != login || session.revoked || session.session.ExpiresAt.Before(now) {
+			continue
+		}
+
+		result := session.session
+		sessions = append(sessions, &result)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+func (s *MemStorage) RevokeSession(ctx context.Context, sid, login string) (SessionOperationResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	session, ok := s.sessions[sid]
+	if !ok || session.session.Login != login || session.revoked {
+		return SessionNotFound, fmt.Errorf("active session %s not found", sid)
+	}
+
+	session.revoked = true
+
+	return SessionSuccess, nil
+}
@@ -0,0 +1,59 @@
+package gophmarktstorage
+
+import (
+	"sync"
+	"time"
+)
+
+type memOrder struct {
+	order         Order
+	login         string
+	updatedAt     time.Time
+	nextCheckAt   time.Time
+	checkAttempts int
+	notRegistered int
+	leaseOwner    string
+	leaseUntil    time.Time
+	events        []*OrderEvent
+}
+
+type memDrawal struct {
+	drawal Drawal
+	login  string
+}
+
+// MemStorage keeps all data in process memory.
+// It follows the same result semantics as PGStorage and is intended for demos and tests.
+type MemStorage struct {
+	sync.RWMutex
+	hasher     PasswordHasher
+	users      map[string]string
+	balances   map[string]*Balance
+	orders     map[string]*memOrder
+	orderList  []*memOrder
+	drawals    map[string]*memDrawal
+	drawalList []*memDrawal
+	sessions   map[string]*memSession
+	ledger     []*memLedgerEntry
+	ledgerTxs  map[string]bool
+	ledgerSeq  int64
+}
+
+func NewMemStorage(hasher PasswordHasher) *MemStorage {
+	return &MemStorage{
+		hasher:     hasher,
+		users:      make(map[string]string),
+		balances:   make(map[string]*Balance),
+		orders:     make(map[string]*memOrder),
+		orderList:  make([]*memOrder, 0),
+		drawals:    make(map[string]*memDrawal),
+		drawalList: make([]*memDrawal, 0),
+		sessions:   make(map[string]*memSession),
+		ledger:     make([]*memLedgerEntry, 0),
+		ledgerTxs:  make(map[string]bool),
+	}
+}
+
+func (s *MemStorage) Close() error {
+	return nil
+}
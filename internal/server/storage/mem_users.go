@@ -0,0 +1,65 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func (s *MemStorage) AddUser(ctx context.Context, login, password string) (UserOperationResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.users[login]; ok {
+		return UserExist, errors.New("user already exist")
+	}
+
+	if !validatePassword(password) {
+		return UserPasswordWrong, errors.New("unsuitable password")
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return UserOperationFailed, fmt.Errorf("failed hash password for login %s: %v", login, err)
+	}
+
+	s.users[login] = hash
+	s.balances[login] = &Balance{Current: startBalance}
+
+	return UserAddSuccess, nil
+}
+
+func (s *MemStorage) CheckUser(ctx context.Context, login, password string) (UserOperationResult, error) {
+	s.RLock()
+	pass, ok := s.users[login]
+	s.RUnlock()
+
+	if !ok {
+		return UserNotFound, errors.New("user not found")
+	}
+
+	// the hash comparison is slow, it runs without the lock
+	ok, rehash, err := checkPassword(s.hasher, pass, password)
+	if err != nil {
+		return UserOperationFailed, fmt.Errorf("failed check password for login %s: %v", login, err)
+	}
+
+	if !ok {
+		return UserPasswordWrong, errors.New("wrong password")
+	}
+
+	if rehash {
+		// the login must not fail because of the upgrade, keep the old value on error
+		hash, err := s.hasher.Hash(password)
+		if err == nil {
+			s.Lock()
+			// the password may be upgraded by a concurrent login
+			if s.users[login] == pass {
+				s.users[login] = hash
+			}
+			s.Unlock()
+		}
+	}
+
+	return UserExist, nil
+}
@@ -0,0 +1,87 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *MemStorage) AddDrawal(ctx context.Context, oid, login string, count Points) (DrawalOperationResult, error) {
+	if count <= 0 {
+		return DrawalAddError, fmt.Errorf("invalid drawal sum %v for order %s", count, oid)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if drawal, ok := s.drawals[oid]; ok {
+		if drawal.login == login {
+			return DrawalAddBefore, fmt.Errorf("Drawal by order %s already upload", oid)
+		}
+
+		return DrawalAddByOther, fmt.Errorf("Drawal by order %s upload by other", oid)
+	}
+
+	balance, ok := s.balances[login]
+	if !ok {
+		return DrawalOperationFailed, fmt.Errorf("no balance for login %s", login)
+	}
+
+	if count > balance.Current {
+		return DrawalNotEnoughPoints, fmt.Errorf("not enough points on balance for login %s", login)
+	}
+
+	err := s.postMovement(&ledgerMovement{
+		kind:      LedgerWithdrawal,
+		login:     login,
+		amount:    -count,
+		order:     oid,
+		createdAt: time.Now(),
+	})
+	if err != nil {
+		return DrawalOperationFailed, fmt.Errorf("failed debit drawal of order %s from login %s: %v", oid, login, err)
+	}
+
+	drawal := &memDrawal{
+		drawal: Drawal{
+			Order:       oid,
+			Sum:         count,
+			ProcessedAt: time.Now().Truncate(time.Second),
+		},
+		login: login,
+	}
+	s.drawals[oid] = drawal
+	s.drawalList = append(s.drawalList, drawal)
+
+	return DrawalAddSuccess, nil
+}
+
+func (s *MemStorage) GetDrawals(ctx context.Context, login string, filter *ListFilter) ([]*Drawal, string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	items := make([]listItem, len(s.drawalList))
+	for i, d := range s.drawalList {
+		items[i] = listItem{time: d.drawal.ProcessedAt, id: d.drawal.Order}
+	}
+
+	drawals := make([]*Drawal, 0)
+	for _, i := range sortItems(items, filter) {
+		d := s.drawalList[i]
+		if d.login != login || !filter.matches(items[i]) {
+			continue
+		}
+
+		drawal := d.drawal
+		drawals = append(drawals, &drawal)
+		if filter != nil && filter.Limit > 0 && len(drawals) > filter.Limit {
+			break
+		}
+	}
+
+	count, next := nextPage(len(drawals), filter, func(i int) *Cursor {
+		return &Cursor{Time: drawals[i].ProcessedAt, ID: drawals[i].Order}
+	})
+
+	return drawals[:count], next, nil
+}
@@ -0,0 +1,2 @@
+-- The misspelled status is not restored
+SELECT 1;
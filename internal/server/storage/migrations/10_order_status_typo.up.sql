@@ -0,0 +1,12 @@
+-- The first schema had the processed status misspelled
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM pg_enum e
+        JOIN pg_type t ON t.oid = e.enumtypid
+        JOIN pg_namespace n ON n.oid = t.typnamespace
+        WHERE n.nspname = 'gophmarkt' AND t.typname = 'order_status' AND e.enumlabel = 'PROCEESED'
+    ) THEN
+        ALTER TYPE gophmarkt.order_status RENAME VALUE 'PROCEESED' TO 'PROCESSED';
+    END IF;
+END $$;
@@ -0,0 +1,2 @@
+ALTER TABLE gophmarkt.orders
+    DROP COLUMN IF EXISTS not_registered;
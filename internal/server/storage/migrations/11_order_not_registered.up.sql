@@ -0,0 +1,3 @@
+-- Checks in a row the accrual system did not know the order, the other answers reset it
+ALTER TABLE gophmarkt.orders
+    ADD COLUMN IF NOT EXISTS not_registered integer NOT NULL DEFAULT 0;
@@ -1,12 +1,18 @@
+-- Every statement is safe to re-run over the schema created before the versioned migrations
+
 CREATE SCHEMA IF NOT EXISTS gophmarkt;
 
 -- Type of the order statuses
-CREATE TYPE gophmarkt.order_status AS ENUM (
-    'NEW',
-    'PROCESSING',
-    'INVALID',
-    'PROCEESED'
-);
+DO $$
+BEGIN
+    CREATE TYPE gophmarkt.order_status AS ENUM (
+        'NEW',
+        'PROCESSING',
+        'INVALID',
+        'PROCESSED'
+    );
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
 
 -- USERS
 
@@ -17,10 +23,14 @@ CREATE TABLE IF NOT EXISTS gophmarkt.users (
 );
 
 -- Set the user as the defining one
-ALTER TABLE gophmarkt.users ADD PRIMARY KEY (login);
+DO $$
+BEGIN
+    ALTER TABLE gophmarkt.users ADD PRIMARY KEY (login);
+EXCEPTION WHEN invalid_table_definition THEN NULL;
+END $$;
 
 -- Index to optimize the search for user
-CREATE UNIQUE INDEX idx_gophmarkt_users ON gophmarkt.users (login);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gophmarkt_users ON gophmarkt.users (login);
 
 -- BALANCE
 -- Table of balance
@@ -31,10 +41,14 @@ CREATE TABLE IF NOT EXISTS gophmarkt.balance (
 );
 
 -- Set the user as the defining one
-ALTER TABLE gophmarkt.balance ADD PRIMARY KEY (login);
+DO $$
+BEGIN
+    ALTER TABLE gophmarkt.balance ADD PRIMARY KEY (login);
+EXCEPTION WHEN invalid_table_definition THEN NULL;
+END $$;
 
 -- Index to optimize the search for balance
-CREATE UNIQUE INDEX idx_gophmarkt_balance ON gophmarkt.balance (login);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gophmarkt_balance ON gophmarkt.balance (login);
 
 -- ORDERS
 -- Table of orders
@@ -48,7 +62,11 @@ CREATE TABLE IF NOT EXISTS gophmarkt.orders (
 );
 
 -- Set the user as the defining one
-ALTER TABLE gophmarkt.orders ADD PRIMARY KEY (order_id);
+DO $$
+BEGIN
+    ALTER TABLE gophmarkt.orders ADD PRIMARY KEY (order_id);
+EXCEPTION WHEN invalid_table_definition THEN NULL;
+END $$;
 
 -- WITHDRAWALS
 -- Table of withdrawals
@@ -60,4 +78,8 @@ CREATE TABLE IF NOT EXISTS gophmarkt.withdrawals (
 );
 
 -- Set the user as the defining one
-ALTER TABLE gophmarkt.withdrawals ADD PRIMARY KEY (order_id);
+DO $$
+BEGIN
+    ALTER TABLE gophmarkt.withdrawals ADD PRIMARY KEY (order_id);
+EXCEPTION WHEN invalid_table_definition THEN NULL;
+END $$;
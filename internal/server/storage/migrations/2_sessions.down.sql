@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_sessions_login;
+DROP TABLE IF EXISTS gophmarkt.sessions;
@@ -0,0 +1,22 @@
+-- SESSIONS
+-- Table of user sessions
+CREATE TABLE IF NOT EXISTS gophmarkt.sessions (
+    session_id   text not null,        -- session id
+    login        text not null,        -- username
+    refresh_hash text not null,        -- hash of the current refresh token
+    user_agent   text not null,        -- client of the session
+    created_at   timestamptz not null, -- session start date
+    updated_at   timestamptz not null, -- last refresh date
+    expires_at   timestamptz not null, -- session expiry date
+    revoked_at   timestamptz           -- session revocation date
+);
+
+-- Set the session id as the defining one
+DO $$
+BEGIN
+    ALTER TABLE gophmarkt.sessions ADD PRIMARY KEY (session_id);
+EXCEPTION WHEN invalid_table_definition THEN NULL;
+END $$;
+
+-- Index to optimize the search for user sessions
+CREATE INDEX IF NOT EXISTS idx_gophmarkt_sessions_login ON gophmarkt.sessions (login);
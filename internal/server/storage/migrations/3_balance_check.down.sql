@@ -0,0 +1 @@
+ALTER TABLE gophmarkt.balance DROP CONSTRAINT IF EXISTS balance_current_non_negative;
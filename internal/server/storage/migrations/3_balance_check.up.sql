@@ -0,0 +1,6 @@
+-- Forbid the overdraft of the balance
+DO $$
+BEGIN
+    ALTER TABLE gophmarkt.balance ADD CONSTRAINT balance_current_non_negative CHECK (current >= 0);
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
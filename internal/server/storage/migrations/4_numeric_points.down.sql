@@ -0,0 +1,9 @@
+ALTER TABLE gophmarkt.withdrawals
+    ALTER COLUMN count TYPE double precision;
+
+ALTER TABLE gophmarkt.orders
+    ALTER COLUMN accrual TYPE double precision;
+
+ALTER TABLE gophmarkt.balance
+    ALTER COLUMN current TYPE double precision,
+    ALTER COLUMN withdrawn TYPE double precision;
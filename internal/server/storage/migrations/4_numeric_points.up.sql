@@ -0,0 +1,10 @@
+-- Keep points as exact decimals with two fractional digits
+ALTER TABLE gophmarkt.balance
+    ALTER COLUMN current TYPE numeric(16,2) USING round(current::numeric, 2),
+    ALTER COLUMN withdrawn TYPE numeric(16,2) USING round(withdrawn::numeric, 2);
+
+ALTER TABLE gophmarkt.orders
+    ALTER COLUMN accrual TYPE numeric(16,2) USING round(accrual::numeric, 2);
+
+ALTER TABLE gophmarkt.withdrawals
+    ALTER COLUMN count TYPE numeric(16,2) USING round(count::numeric, 2);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_ledger_account;
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_ledger_reversal;
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_ledger_tx;
+DROP TABLE IF EXISTS gophmarkt.ledger;
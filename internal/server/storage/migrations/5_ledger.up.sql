@@ -0,0 +1,73 @@
+-- LEDGER
+-- Table of immutable balance movements, every movement is a pair of postings with zero sum
+CREATE TABLE IF NOT EXISTS gophmarkt.ledger (
+    entry_id    bigserial not null,     -- posting id
+    tx_id       text not null,          -- movement id shared by both postings
+    account     text not null,          -- user:<login> or system:<name>
+    login       text,                   -- owner of the user account
+    kind        text not null,          -- accrual, withdrawal, adjustment or reversal
+    amount      numeric(16,2) not null, -- signed amount, positive credits the account
+    order_id    text,                   -- related order
+    reversal_of text,                   -- reversed movement
+    created_at  timestamptz not null,   -- posting date
+    CONSTRAINT ledger_kind_check CHECK (kind IN ('accrual', 'withdrawal', 'adjustment', 'reversal'))
+);
+
+-- Set the posting id as the defining one
+DO $$
+BEGIN
+    ALTER TABLE gophmarkt.ledger ADD PRIMARY KEY (entry_id);
+EXCEPTION WHEN invalid_table_definition THEN NULL;
+END $$;
+
+-- One posting per account in a movement
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gophmarkt_ledger_tx ON gophmarkt.ledger (tx_id, account);
+
+-- A movement can be reversed only once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gophmarkt_ledger_reversal ON gophmarkt.ledger (reversal_of, account) WHERE reversal_of IS NOT NULL;
+
+-- Index to optimize the history of the account
+CREATE INDEX IF NOT EXISTS idx_gophmarkt_ledger_account ON gophmarkt.ledger (account, entry_id);
+
+-- Backfill the history of the existing balances, the movements already in the ledger are kept
+
+-- accruals of the processed orders
+INSERT INTO gophmarkt.ledger (tx_id, account, login, kind, amount, order_id, created_at)
+SELECT 'accrual:' || o.order_id, p.account, p.login, 'accrual', p.sign * o.accrual, o.order_id, o.date_update
+FROM gophmarkt.orders o
+CROSS JOIN LATERAL (VALUES ('user:' || o.login, o.login, 1), ('system:accrual', NULL, -1)) AS p(account, login, sign)
+WHERE o.status::text = 'PROCESSED' AND o.accrual > 0
+ON CONFLICT DO NOTHING;
+
+-- withdrawals by orders
+INSERT INTO gophmarkt.ledger (tx_id, account, login, kind, amount, order_id, created_at)
+SELECT 'withdrawal:' || w.order_id, p.account, p.login, 'withdrawal', -p.sign * w.count, w.order_id, w.offdate
+FROM gophmarkt.withdrawals w
+CROSS JOIN LATERAL (VALUES ('user:' || w.login, w.login, 1), ('system:withdrawal', NULL, -1)) AS p(account, login, sign)
+ON CONFLICT DO NOTHING;
+
+-- withdrawals without orders
+INSERT INTO gophmarkt.ledger (tx_id, account, login, kind, amount, created_at)
+SELECT 'withdrawal:opening:' || d.login, p.account, p.login, 'withdrawal', -p.sign * d.amount, now()
+FROM (
+    SELECT b.login, COALESCE(b.withdrawn, 0) - COALESCE(SUM(w.count), 0) AS amount
+    FROM gophmarkt.balance b
+    LEFT JOIN gophmarkt.withdrawals w ON w.login = b.login
+    GROUP BY b.login, b.withdrawn
+) d
+CROSS JOIN LATERAL (VALUES ('user:' || d.login, d.login, 1), ('system:withdrawal', NULL, -1)) AS p(account, login, sign)
+WHERE d.amount <> 0
+ON CONFLICT DO NOTHING;
+
+-- the rest of the current balance
+INSERT INTO gophmarkt.ledger (tx_id, account, login, kind, amount, created_at)
+SELECT 'adjustment:opening:' || d.login, p.account, p.login, 'adjustment', p.sign * d.amount, now()
+FROM (
+    SELECT b.login, b.current - COALESCE(SUM(l.amount), 0) AS amount
+    FROM gophmarkt.balance b
+    LEFT JOIN gophmarkt.ledger l ON l.account = 'user:' || b.login
+    GROUP BY b.login, b.current
+) d
+CROSS JOIN LATERAL (VALUES ('user:' || d.login, d.login, 1), ('system:adjustment', NULL, -1)) AS p(account, login, sign)
+WHERE d.amount <> 0
+ON CONFLICT DO NOTHING;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_ledger_accrual;
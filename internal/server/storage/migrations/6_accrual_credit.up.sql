@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gophmarkt_ledger_accrual ON gophmarkt.ledger (order_id, account) WHERE kind = 'accrual';
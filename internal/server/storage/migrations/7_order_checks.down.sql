@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_orders_check;
+
+ALTER TABLE gophmarkt.orders
+    DROP COLUMN IF EXISTS lease_until,
+    DROP COLUMN IF EXISTS lease_owner,
+    DROP COLUMN IF EXISTS check_attempts,
+    DROP COLUMN IF EXISTS next_check_at;
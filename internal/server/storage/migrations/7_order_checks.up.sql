@@ -0,0 +1,8 @@
+-- Schedule of the checks in the accrual system
+ALTER TABLE gophmarkt.orders
+    ADD COLUMN IF NOT EXISTS next_check_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS check_attempts integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS lease_owner text,
+    ADD COLUMN IF NOT EXISTS lease_until timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_gophmarkt_orders_check ON gophmarkt.orders (next_check_at) WHERE status IN ('NEW', 'PROCESSING');
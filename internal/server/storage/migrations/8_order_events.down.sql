@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_order_events_order;
+DROP TABLE IF EXISTS gophmarkt.order_events;
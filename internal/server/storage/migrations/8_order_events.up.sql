@@ -0,0 +1,25 @@
+-- Table of the order status transitions
+CREATE TABLE IF NOT EXISTS gophmarkt.order_events (
+    event_id    bigserial PRIMARY KEY,
+    order_id    text NOT NULL,
+    status_from gophmarkt.order_status,
+    status_to   gophmarkt.order_status NOT NULL,
+    source      text NOT NULL,
+    created_at  timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_gophmarkt_order_events_order ON gophmarkt.order_events (order_id, event_id);
+
+-- The history of the existing orders without one starts from their upload and the current status
+INSERT INTO gophmarkt.order_events (order_id, status_from, status_to, source, created_at)
+SELECT order_id, NULL, 'NEW', 'user', date_upload
+FROM gophmarkt.orders o
+WHERE NOT EXISTS (SELECT 1 FROM gophmarkt.order_events e WHERE e.order_id = o.order_id AND e.status_from IS NULL)
+ORDER BY date_upload;
+
+INSERT INTO gophmarkt.order_events (order_id, status_from, status_to, source, created_at)
+SELECT order_id, 'NEW', status, 'accrual_poll', date_update
+FROM gophmarkt.orders o
+WHERE status::text <> 'NEW'
+  AND NOT EXISTS (SELECT 1 FROM gophmarkt.order_events e WHERE e.order_id = o.order_id AND e.status_from IS NOT NULL)
+ORDER BY date_update;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_withdrawals_list;
+DROP INDEX IF EXISTS gophmarkt.idx_gophmarkt_orders_list;
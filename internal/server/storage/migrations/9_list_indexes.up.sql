@@ -0,0 +1,3 @@
+-- Keyset pagination of the orders and withdrawals of the login from the newest one
+CREATE INDEX IF NOT EXISTS idx_gophmarkt_orders_list ON gophmarkt.orders (login, date_upload DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_gophmarkt_withdrawals_list ON gophmarkt.withdrawals (login, offdate DESC, order_id DESC);
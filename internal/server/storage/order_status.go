@@ -0,0 +1,52 @@
+package gophmarktstorage
+
+import (
+	"errors"
+	"time"
+)
+
+type (
+	OrderEventSource string
+	// OrderEvent is one transition of the order status.
+	OrderEvent struct {
+		From      OrderStatus      `json:"from,omitempty"`
+		To        OrderStatus      `json:"status"`
+		Source    OrderEventSource `json:"source"`
+		CreatedAt time.Time        `json:"created_at"`
+	}
+)
+
+const (
+	orderEventsTable = "gophmarkt.order_events"
+
+	// the order is uploaded by the user
+	EventSourceUser OrderEventSource = "user"
+	// the status is received by polling the accrual system
+	EventSourcePoller OrderEventSource = "accrual_poll"
+	// the status is pushed by the accrual system
+	EventSourceCallback OrderEventSource = "accrual_callback"
+)
+
+var ErrOrderTransition = errors.New("forbidden order status transition")
+
+// orderTransitions is the state machine of the order: NEW -> PROCESSING -> PROCESSED|INVALID.
+// The accrual system may report the final status right away, so NEW may skip PROCESSING.
+// PROCESSED and INVALID are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusNew:        {OrderStatusProcessing, OrderStatusProcessed, OrderStatusInvalid},
+	OrderStatusProcessing: {OrderStatusProcessed, OrderStatusInvalid},
+}
+
+func (s OrderStatus) IsTerminal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+func (s OrderStatus) CanTransit(to OrderStatus) bool {
+	for _, status := range orderTransitions[s] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
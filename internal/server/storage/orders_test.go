@@ -0,0 +1,50 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCountUnprocessedOrders(t *testing.T) {
+	testCountUnprocessedOrders(t, newTestMemStorage(t))
+}
+
+func TestCountUnprocessedOrdersPostgres(t *testing.T) {
+	testCountUnprocessedOrders(t, newTestPGStorage(t))
+}
+
+// testCountUnprocessedOrders counts the new orders until one of them becomes INVALID.
+func testCountUnprocessedOrders(t *testing.T, s Storage) {
+	const orders = 3
+
+	ctx := context.Background()
+	// the database may already have the orders of the other runs
+	before, err := s.CountUnprocessedOrders(ctx)
+	if err != nil {
+		t.Fatalf("failed count orders: %v", err)
+	}
+
+	prefix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	login := "count-" + prefix
+	for i := 0; i < orders; i++ {
+		if _, err = s.AddOrder(ctx, fmt.Sprintf("%s%d", prefix, i), login); err != nil {
+			t.Fatalf("failed add order: %v", err)
+		}
+	}
+
+	err = s.UpdateOrder(ctx, &Order{Number: prefix + "0", Status: OrderStatusInvalid, UploadedAt: time.Now()}, EventSourcePoller)
+	if err != nil {
+		t.Fatalf("failed update order: %v", err)
+	}
+
+	count, err := s.CountUnprocessedOrders(ctx)
+	if err != nil {
+		t.Fatalf("failed count orders: %v", err)
+	}
+	if count-before != orders-1 {
+		t.Errorf("counted %d new unprocessed orders, want %d", count-before, orders-1)
+	}
+}
@@ -0,0 +1,189 @@
+package gophmarktstorage
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+	hashLegacy   = "plain"
+
+	// stored hashes are self-describing, the prefix defines the algorithm
+	bcryptPrefix   = "$2"
+	argon2idPrefix = "$argon2id$"
+	argon2idFormat = "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s"
+
+	bcryptCost      = bcrypt.DefaultCost
+	argon2idTime    = 1
+	argon2idMemory  = 64 * 1024
+	argon2idThreads = 4
+	argon2idKeyLen  = 32
+	argon2idSaltLen = 16
+)
+
+// PasswordHasher produces and verifies stored password hashes.
+type PasswordHasher interface {
+	// Algorithm returns the name of the algorithm used for the new hashes.
+	Algorithm() string
+	Hash(password string) (string, error)
+	Compare(hash, password string) (bool, error)
+}
+
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	switch algorithm {
+	case HashBcrypt, "":
+		return &bcryptHasher{cost: bcryptCost}, nil
+	case HashArgon2id:
+		return &argon2idHasher{
+			time:    argon2idTime,
+			memory:  argon2idMemory,
+			threads: argon2idThreads,
+			keyLen:  argon2idKeyLen,
+			saltLen: argon2idSaltLen,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown password hash algorithm %s", algorithm)
+}
+
+// hashAlgorithm detects the algorithm of the stored password by its prefix.
+// Anything without a known prefix is a legacy plaintext password.
+func hashAlgorithm(stored string) string {
+	switch {
+	case strings.HasPrefix(stored, argon2idPrefix):
+		return HashArgon2id
+	case strings.HasPrefix(stored, bcryptPrefix):
+		if _, err := bcrypt.Cost([]byte(stored)); err == nil {
+			return HashBcrypt
+		}
+	}
+
+	return hashLegacy
+}
+
+// checkPassword compares the password with the stored value in constant time.
+// rehash reports that the stored value should be replaced by a fresh hash.
+func checkPassword(hasher PasswordHasher, stored, password string) (ok bool, rehash bool, err error) {
+	algorithm := hashAlgorithm(stored)
+	switch algorithm {
+	case HashBcrypt:
+		ok, err = (&bcryptHasher{}).Compare(stored, password)
+	case HashArgon2id:
+		ok, err = (&argon2idHasher{}).Compare(stored, password)
+	default:
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	}
+
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	return true, algorithm != hasher.Algorithm(), nil
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (h *bcryptHasher) Algorithm() string {
+	return HashBcrypt
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed generate bcrypt hash: %v", err)
+	}
+
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Compare(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed compare bcrypt hash: %v", err)
+	}
+
+	return true, nil
+}
+
+type argon2idHasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	keyLen  uint32
+	saltLen uint32
+}
+
+func (h *argon2idHasher) Algorithm() string {
+	return HashArgon2id
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed generate salt: %v", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, h.keyLen)
+
+	return fmt.Sprintf(
+		argon2idFormat,
+		argon2.Version,
+		h.memory,
+		h.time,
+		h.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Compare takes the argon2id parameters from the stored hash, not from the hasher.
+func (h *argon2idHasher) Compare(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, errors.New("invalid argon2id hash format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, fmt.Errorf("invalid argon2id hash version: %v", err)
+	}
+
+	if version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("invalid argon2id hash parameters: %v", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id hash salt: %v", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id hash key: %v", err)
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
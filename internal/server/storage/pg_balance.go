@@ -3,14 +3,16 @@ package gophmarktstorage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
 type Balance struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn,omitempty"`
+	Current   Points `json:"current"`
+	Withdrawn Points `json:"withdrawn,omitempty"`
 }
 
 const (
@@ -18,79 +20,67 @@ const (
 	startBalance = 0
 )
 
-func (s *PGStorage) AddBalance(ctx context.Context, login string, count float64) error {
-	query, args, err := sq.Select("current").From(balanceTable).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
+// AddBalance records a manual adjustment of the balance, a negative count decreases it.
+func (s *PGStorage) AddBalance(ctx context.Context, login string, count Points) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed generate select balance query for login %s: %v", login, err)
-	}
-
-	row := s.db.QueryRowContext(ctx, query, args...)
-	if row.Err() != nil {
-		return fmt.Errorf("failed execute select balance query for login %s: %v", login, err)
-	}
-
-	var current float64
-	err = row.Scan(&current)
-	if err == sql.ErrNoRows {
-		query, args, err = sq.Insert(balanceTable).Columns("login", "current", "withdrawn").Values(login, count, 0).PlaceholderFormat(sq.Dollar).ToSql()
-		if err != nil {
-			return fmt.Errorf("failed generate init balance query for login %s: %v", login, err)
-		}
-
-		_, err = s.db.ExecContext(ctx, query, args...)
-		if err != nil {
-			return fmt.Errorf("failed execute init balance query for login %s: %v", login, err)
-		}
-
-		return nil
+		return fmt.Errorf("failed init DB transaction: %v", err)
 	}
+	defer tx.Rollback()
 
+	err = postMovement(ctx, tx, &ledgerMovement{
+		kind:      LedgerAdjustment,
+		login:     login,
+		amount:    count,
+		createdAt: time.Now(),
+	})
 	if err != nil {
-		return fmt.Errorf("failed get balance for login %s: %v", login, err)
-	} else {
-		query, args, err = sq.Update(balanceTable).Set("current", current+count).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
-		if err != nil {
-			return fmt.Errorf("failed generate update balance query for login %s: %v", login, err)
-		}
+		return fmt.Errorf("failed adjust balance for login %s: %v", login, err)
+	}
 
-		_, err = s.db.ExecContext(ctx, query, args...)
-		if err != nil {
-			return fmt.Errorf("failed execute update balance query for login %s: %v", login, err)
-		}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed commit query result: %v", err)
 	}
 
 	return nil
 }
 
-func (s *PGStorage) DrawnBalance(ctx context.Context, login string, count float64) error {
-	query, args, err := sq.Select("current", "withdrawn").From(balanceTable).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
+// DrawnBalance records a withdrawal not bound to an order.
+func (s *PGStorage) DrawnBalance(ctx context.Context, login string, count Points) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed generate select balance with drawn query for login %s: %v", login, err)
+		return fmt.Errorf("failed init DB transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	row := s.db.QueryRowContext(ctx, query, args...)
-	if row.Err() != nil {
-		return fmt.Errorf("failed execute select balance with drawn query for login %s: %v", login, err)
+	query, args, err := sq.Select("current").From(balanceTable).Where(sq.Eq{"login": login}).Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate select balance query for login %s: %v", login, err)
 	}
 
-	var current, withdrawn float64
-	err = row.Scan(&current, &withdrawn)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("no balance for login %s: %v", login, err)
+	var current Points
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no balance for login %s", login)
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed get balance for login %s: %v", login, err)
 	}
 
-	query, args, err = sq.Update(balanceTable).Set("current", current-count).Set("withdrawn", withdrawn+count).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
+	err = postMovement(ctx, tx, &ledgerMovement{
+		kind:      LedgerWithdrawal,
+		login:     login,
+		amount:    -count,
+		createdAt: time.Now(),
+	})
 	if err != nil {
-		return fmt.Errorf("failed generate update balance with drawn query for login %s: %v", login, err)
+		return fmt.Errorf("failed drawn balance for login %s: %v", login, err)
 	}
 
-	_, err = s.db.ExecContext(ctx, query, args...)
-	if err != nil {
-		return fmt.Errorf("failed execute update balance with drawn query for login %s: %v", login, err)
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed commit query result: %v", err)
 	}
 
 	return nil
@@ -107,7 +97,7 @@ func (s *PGStorage) GetBalance(ctx context.Context, login string) (*Balance, err
 		return nil, fmt.Errorf("failed execute select balance with drawn query for login %s: %v", login, err)
 	}
 
-	var current, withdrawn float64
+	var current, withdrawn Points
 	err = row.Scan(&current, &withdrawn)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("no balance for login %s: %v", login, err)
@@ -123,16 +113,56 @@ func (s *PGStorage) GetBalance(ctx context.Context, login string) (*Balance, err
 	}, nil
 }
 
+// DropBalance closes the account: the rest of the points is written off by an adjustment
+// and the materialised balance is removed. The ledger entries are kept.
 func (s *PGStorage) DropBalance(ctx context.Context, login string) error {
-	query, args, err := sq.Delete(balanceTable).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed init DB transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := sq.Select("current").From(balanceTable).Where(sq.Eq{"login": login}).Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate select balance query for login %s: %v", login, err)
+	}
+
+	var current Points
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed get balance for login %s: %v", login, err)
+	}
+
+	if current != 0 {
+		_, err = insertMovement(ctx, tx, &ledgerMovement{
+			kind:      LedgerAdjustment,
+			login:     login,
+			amount:    -current,
+			createdAt: time.Now(),
+		}, accountAdjustment)
+		if err != nil {
+			return fmt.Errorf("failed write off balance for login %s: %v", login, err)
+		}
+	}
+
+	query, args, err = sq.Delete(balanceTable).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return fmt.Errorf("failed generate delete balance query for login %s: %v", login, err)
 	}
 
-	_, err = s.db.ExecContext(ctx, query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed execute delete balance query for login %s: %v", login, err)
 	}
 
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed commit query result: %v", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,379 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type (
+	LedgerEntryKind string
+	// LedgerEntry is one immutable posting on the user account.
+	// Every movement has a counter posting on a system account with the opposite amount.
+	LedgerEntry struct {
+		ID         int64           `json:"id"`
+		TxID       string          `json:"tx_id"`
+		Kind       LedgerEntryKind `json:"type"`
+		Amount     Points          `json:"amount"`
+		Order      string          `json:"order,omitempty"`
+		ReversalOf string          `json:"reversal_of,omitempty"`
+		CreatedAt  time.Time       `json:"created_at"`
+	}
+	// BalanceMismatch is a materialised balance that differs from the sum of its ledger entries.
+	BalanceMismatch struct {
+		Login           string
+		Current         Points
+		Withdrawn       Points
+		LedgerCurrent   Points
+		LedgerWithdrawn Points
+	}
+	// LedgerTotals is the sum of the points of all users by the kind of movement, the reversals are not subtracted.
+	LedgerTotals struct {
+		Accrued   Points
+		Withdrawn Points
+	}
+)
+
+const (
+	ledgerTable = "gophmarkt.ledger"
+
+	LedgerAccrual    LedgerEntryKind = "accrual"
+	LedgerWithdrawal LedgerEntryKind = "withdrawal"
+	LedgerAdjustment LedgerEntryKind = "adjustment"
+	LedgerReversal   LedgerEntryKind = "reversal"
+
+	userAccountPrefix = "user:"
+	accountAccrual    = "system:accrual"
+	accountWithdrawal = "system:withdrawal"
+	accountAdjustment = "system:adjustment"
+
+	ledgerTxIDLen = 16
+)
+
+// counterAccounts is the system side of the movements of every kind.
+var counterAccounts = map[LedgerEntryKind]string{
+	LedgerAccrual:    accountAccrual,
+	LedgerWithdrawal: accountWithdrawal,
+	LedgerAdjustment: accountAdjustment,
+}
+
+// ledgerMovement is a balanced pair of postings.
+type ledgerMovement struct {
+	txID       string
+	kind       LedgerEntryKind
+	login      string
+	amount     Points
+	order      string
+	reversalOf string
+	createdAt  time.Time
+}
+
+func userAccount(login string) string {
+	return userAccountPrefix + login
+}
+
+func accrualTxID(oid string) string {
+	return string(LedgerAccrual) + ":" + oid
+}
+
+func newLedgerTxID() (string, error) {
+	buf := make([]byte, ledgerTxIDLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed generate ledger transaction id: %v", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// insertMovement writes both postings of the movement.
+// The user account receives the amount, the counter account receives its negation.
+func insertMovement(ctx context.Context, tx *sql.Tx, movement *ledgerMovement, counterAccount string) (int64, error) {
+	if movement.txID == "" {
+		txID, err := newLedgerTxID()
+		if err != nil {
+			return 0, err
+		}
+		movement.txID = txID
+	}
+
+	order := sql.NullString{String: movement.order, Valid: movement.order != ""}
+	reversalOf := sql.NullString{String: movement.reversalOf, Valid: movement.reversalOf != ""}
+	query, args, err := sq.Insert(ledgerTable).
+		Columns("tx_id", "account", "login", "kind", "amount", "order_id", "reversal_of", "created_at").
+		Values(movement.txID, userAccount(movement.login), movement.login, movement.kind, movement.amount, order, reversalOf, movement.createdAt).
+		Values(movement.txID, counterAccount, nil, movement.kind, -movement.amount, order, reversalOf, movement.createdAt).
+		Suffix("ON CONFLICT DO NOTHING").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed generate insert ledger query for login %s: %v", movement.login, err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed execute insert ledger query for login %s: %v", movement.login, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed get count of the affected rows: %v", err)
+	}
+
+	return n, nil
+}
+
+// postMovement records the movement and applies it to the materialised balance in the same transaction.
+func postMovement(ctx context.Context, tx *sql.Tx, movement *ledgerMovement) error {
+	n, err := insertMovement(ctx, tx, movement, counterAccounts[movement.kind])
+	if err != nil {
+		return err
+	}
+
+	if n != 2 {
+		return fmt.Errorf("ledger transaction %s is already posted", movement.txID)
+	}
+
+	var withdrawn Points
+	if movement.kind == LedgerWithdrawal {
+		withdrawn = -movement.amount
+	}
+
+	return applyBalance(ctx, tx, movement.login, movement.amount, withdrawn)
+}
+
+// creditAccrual posts the accrual of the order once.
+// The movement id is derived from the order, an already posted credit is left as is.
+func creditAccrual(ctx context.Context, tx *sql.Tx, login, oid string, accrual Points) error {
+	movement := &ledgerMovement{
+		txID:      accrualTxID(oid),
+		kind:      LedgerAccrual,
+		login:     login,
+		amount:    accrual,
+		order:     oid,
+		createdAt: time.Now(),
+	}
+
+	n, err := insertMovement(ctx, tx, movement, accountAccrual)
+	if err != nil {
+		return err
+	}
+
+	switch n {
+	case 0:
+		return nil
+	case 2:
+		return applyBalance(ctx, tx, login, accrual, 0)
+	}
+
+	return fmt.Errorf("accrual of order %s is partially posted", oid)
+}
+
+// applyBalance shifts the materialised balance, creating it when absent.
+func applyBalance(ctx context.Context, tx *sql.Tx, login string, current, withdrawn Points) error {
+	query, args, err := sq.Insert(balanceTable).Columns("login", "current", "withdrawn").
+		Values(login, current, withdrawn).
+		Suffix("ON CONFLICT (login) DO UPDATE SET current = balance.current + EXCLUDED.current, withdrawn = balance.withdrawn + EXCLUDED.withdrawn").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate update balance query for login %s: %v", login, err)
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed execute update balance query for login %s: %w", login, err)
+	}
+
+	return nil
+}
+
+// GetLedger returns the entries of the login account from the newest one.
+func (s *PGStorage) GetLedger(ctx context.Context, login string, limit, offset int) ([]*LedgerEntry, error) {
+	entries := make([]*LedgerEntry, 0)
+	query, args, err := sq.Select("entry_id", "tx_id", "kind", "amount", "order_id", "reversal_of", "created_at").
+		From(ledgerTable).Where(sq.Eq{"account": userAccount(login)}).
+		OrderBy("entry_id DESC").Limit(uint64(limit)).Offset(uint64(offset)).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select ledger query for login %s: %v", login, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute select ledger query for login %s: %v", login, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order, reversalOf sql.NullString
+		entry := &LedgerEntry{}
+		err = rows.Scan(&entry.ID, &entry.TxID, &entry.Kind, &entry.Amount, &order, &reversalOf, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan ledger row for login %s: %v", login, err)
+		}
+		entry.Order = order.String
+		entry.ReversalOf = reversalOf.String
+
+		entries = append(entries, entry)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan ledger rows for login %s: %v", login, rows.Err())
+	}
+
+	return entries, nil
+}
+
+// ReverseTransaction posts the mirror of the ledger transaction and undoes its effect on the balance.
+func (s *PGStorage) ReverseTransaction(ctx context.Context, txID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed init DB transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := sq.Select("login", "kind", "amount", "order_id").From(ledgerTable).
+		Where(sq.Eq{"tx_id": txID}).Where(sq.NotEq{"login": nil}).Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate select ledger transaction query for %s: %v", txID, err)
+	}
+
+	var login string
+	var kind LedgerEntryKind
+	var amount Points
+	var order sql.NullString
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&login, &kind, &amount, &order)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("ledger transaction %s not found", txID)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed get ledger transaction %s: %v", txID, err)
+	}
+
+	if kind == LedgerReversal {
+		return fmt.Errorf("ledger transaction %s is a reversal itself", txID)
+	}
+
+	movement := &ledgerMovement{
+		kind:       LedgerReversal,
+		login:      login,
+		amount:     -amount,
+		order:      order.String,
+		reversalOf: txID,
+		createdAt:  time.Now(),
+	}
+
+	n, err := insertMovement(ctx, tx, movement, counterAccounts[kind])
+	if err != nil {
+		return err
+	}
+
+	if n != 2 {
+		return fmt.Errorf("ledger transaction %s is already reversed", txID)
+	}
+
+	var withdrawn Points
+	if kind == LedgerWithdrawal {
+		withdrawn = amount
+	}
+
+	err = applyBalance(ctx, tx, login, movement.amount, withdrawn)
+	if isCheckViolation(err) {
+		return fmt.Errorf("not enough points on balance for login %s to reverse %s", login, txID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed commit query result: %v", err)
+	}
+
+	return nil
+}
+
+// Reconcile compares every materialised balance with the sum of its ledger entries.
+func (s *PGStorage) Reconcile(ctx context.Context) ([]*BalanceMismatch, error) {
+	mismatches := make([]*BalanceMismatch, 0)
+	// withdrawn is the sum of withdrawals together with their reversals
+	withdrawnExpr := "COALESCE(-SUM(l.amount) FILTER (WHERE l.kind = 'withdrawal' OR r.kind = 'withdrawal'), 0)"
+	query, args, err := sq.Select("b.login", "b.current", "COALESCE(b.withdrawn, 0)", "COALESCE(SUM(l.amount), 0)", withdrawnExpr).
+		From(balanceTable+" b").
+		LeftJoin(ledgerTable+" l ON l.account = 'user:' || b.login").
+		LeftJoin("(SELECT DISTINCT tx_id, kind FROM "+ledgerTable+") r ON r.tx_id = l.reversal_of").
+		GroupBy("b.login", "b.current", "b.withdrawn").
+		Having("b.current <> COALESCE(SUM(l.amount), 0) OR COALESCE(b.withdrawn, 0) <> " + withdrawnExpr).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate reconcile query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute reconcile query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		mismatch := &BalanceMismatch{}
+		err = rows.Scan(&mismatch.Login, &mismatch.Current, &mismatch.Withdrawn, &mismatch.LedgerCurrent, &mismatch.LedgerWithdrawn)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan reconcile row: %v", err)
+		}
+
+		mismatches = append(mismatches, mismatch)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan reconcile rows: %v", rows.Err())
+	}
+
+	return mismatches, nil
+}
+
+func (s *PGStorage) GetLedgerTotals(ctx context.Context) (*LedgerTotals, error) {
+	query, args, err := sq.Select("kind", "COALESCE(SUM(amount), 0)").From(ledgerTable).
+		Where(sq.And{
+			sq.NotEq{"login": nil},
+			sq.Eq{"kind": []LedgerEntryKind{LedgerAccrual, LedgerWithdrawal}},
+		}).
+		GroupBy("kind").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate ledger totals query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute ledger totals query: %v", err)
+	}
+	defer rows.Close()
+
+	totals := &LedgerTotals{}
+	for rows.Next() {
+		var kind LedgerEntryKind
+		var amount Points
+		if err = rows.Scan(&kind, &amount); err != nil {
+			return nil, fmt.Errorf("failed scan ledger totals row: %v", err)
+		}
+
+		switch kind {
+		case LedgerAccrual:
+			totals.Accrued = amount
+		case LedgerWithdrawal:
+			totals.Withdrawn = -amount
+		}
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan ledger totals rows: %v", rows.Err())
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,217 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// migrationsFS is the only source of the database schema.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+const (
+	migrationsDir = "migrations"
+	// version table of golang-migrate
+	migrationsTable = "schema_migrations"
+)
+
+var (
+	ErrSchemaDirty    = errors.New("database schema is dirty")
+	ErrSchemaNewer    = errors.New("database schema is newer than the service")
+	ErrSchemaOutdated = errors.New("database schema is older than the service")
+)
+
+// SchemaStatus is the state of the database schema against the embedded migrations.
+type SchemaStatus struct {
+	// applied migration, zero for the empty database
+	Version uint
+	// the last migration failed and the schema needs to be fixed by hand
+	Dirty bool
+	// last embedded migration
+	Latest uint
+}
+
+// Pending says the schema is behind the embedded migrations.
+func (s *SchemaStatus) Pending() bool {
+	return s.Version < s.Latest
+}
+
+// Check returns an error for the schema the service must not run on.
+func (s *SchemaStatus) Check() error {
+	if s.Dirty {
+		return fmt.Errorf("%w: migration %d failed, fix it and force the version", ErrSchemaDirty, s.Version)
+	}
+
+	if s.Version > s.Latest {
+		return fmt.Errorf("%w: version %d, latest known %d", ErrSchemaNewer, s.Version, s.Latest)
+	}
+
+	return nil
+}
+
+// Migrator applies the embedded migrations to the database.
+type Migrator struct {
+	migrate *migrate.Migrate
+	latest  uint
+}
+
+func NewMigrator(dsn string) (*Migrator, error) {
+	latest, err := latestMigration()
+	if err != nil {
+		return nil, err
+	}
+
+	srcDriver, err := iofs.New(migrationsFS, migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed read embedded migrations: %v", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", srcDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrator: %v", err)
+	}
+
+	return &Migrator{
+		migrate: m,
+		latest:  latest,
+	}, nil
+}
+
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.migrate.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+func (m *Migrator) Status() (*SchemaStatus, error) {
+	version, dirty, err := m.migrate.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return nil, fmt.Errorf("failed get schema version: %v", err)
+	}
+
+	return &SchemaStatus{
+		Version: version,
+		Dirty:   dirty,
+		Latest:  m.latest,
+	}, nil
+}
+
+// Up applies all the pending migrations, it refuses the dirty or newer schema.
+func (m *Migrator) Up() error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	if err = status.Check(); err != nil {
+		return err
+	}
+
+	if err = m.migrate.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %v", err)
+	}
+
+	return nil
+}
+
+// Down reverts the last steps migrations.
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("invalid number of steps %d", steps)
+	}
+
+	if err := m.migrate.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to revert migrations: %v", err)
+	}
+
+	return nil
+}
+
+// Force sets the version without running the migrations and clears the dirty flag.
+func (m *Migrator) Force(version int) error {
+	if err := m.migrate.Force(version); err != nil {
+		return fmt.Errorf("failed to force version %d: %v", version, err)
+	}
+
+	return nil
+}
+
+// SchemaStatus reads the applied migration without locking the schema.
+func (s *PGStorage) SchemaStatus(ctx context.Context) (*SchemaStatus, error) {
+	latest, err := latestMigration()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SchemaStatus{Latest: latest}
+	err = s.db.QueryRowContext(ctx, "SELECT version, dirty FROM "+migrationsTable+" LIMIT 1").Scan(&status.Version, &status.Dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed get schema version: %v", err)
+	}
+
+	return status, nil
+}
+
+// CheckSchema returns an error unless the schema is at the last embedded migration.
+func (s *PGStorage) CheckSchema(ctx context.Context) error {
+	status, err := s.SchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = status.Check(); err != nil {
+		return err
+	}
+
+	if status.Pending() {
+		return fmt.Errorf("%w: version %d, latest known %d", ErrSchemaOutdated, status.Version, status.Latest)
+	}
+
+	return nil
+}
+
+// MigrateUp brings the schema to the latest embedded migration.
+func MigrateUp(dsn string) error {
+	m, err := NewMigrator(dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	return m.Up()
+}
+
+// latestMigration returns the version of the last embedded migration.
+func latestMigration() (uint, error) {
+	entries, err := fs.ReadDir(migrationsFS, migrationsDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed read embedded migrations: %v", err)
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		migration, err := source.DefaultParse(entry.Name())
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file %s: %v", entry.Name(), err)
+		}
+
+		if migration.Version > latest {
+			latest = migration.Version
+		}
+	}
+
+	if latest == 0 {
+		return 0, errors.New("no embedded migrations")
+	}
+
+	return latest, nil
+}
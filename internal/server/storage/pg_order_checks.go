@@ -0,0 +1,94 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// OrderCheck is an unprocessed order claimed for the check in the accrual system.
+type OrderCheck struct {
+	Number   string
+	Status   OrderStatus
+	Attempts int
+	// answers in a row the order is not registered in the accrual system
+	NotRegistered int
+}
+
+// ClaimOrders leases up to limit orders due for the check to the owner.
+// Rows locked by another claim are skipped, so several replicas never check the same order at once.
+func (s *PGStorage) ClaimOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]*OrderCheck, error) {
+	now := time.Now()
+	due := sq.Select("order_id").From(ordersTable).
+		Where(sq.Eq{"status": []OrderStatus{OrderStatusNew, OrderStatusProcessing}}).
+		Where(sq.LtOrEq{"next_check_at": now}).
+		Where(sq.Or{sq.Eq{"lease_until": nil}, sq.Lt{"lease_until": now}}).
+		OrderBy("next_check_at").Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	query, args, err := sq.Update(ordersTable).
+		Set("lease_owner", owner).
+		Set("lease_until", now.Add(lease)).
+		Where(sq.Expr("order_id IN (?)", due)).
+		Suffix("RETURNING order_id, status, check_attempts, not_registered").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate claim orders query: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute claim orders query: %v", err)
+	}
+	defer rows.Close()
+
+	checks := make([]*OrderCheck, 0, limit)
+	for rows.Next() {
+		check := &OrderCheck{}
+		err = rows.Scan(&check.Number, &check.Status, &check.Attempts, &check.NotRegistered)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan claimed order: %v", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan claimed orders rows: %v", rows.Err())
+	}
+
+	return checks, nil
+}
+
+// ScheduleOrderCheck releases the lease of the owner and sets the time of the next check.
+func (s *PGStorage) ScheduleOrderCheck(ctx context.Context, oid, owner string, attempts, notRegistered int, next time.Time) error {
+	query, args, err := sq.Update(ordersTable).
+		Set("next_check_at", next).
+		Set("check_attempts", attempts).
+		Set("not_registered", notRegistered).
+		Set("lease_owner", nil).
+		Set("lease_until", nil).
+		Where(sq.Eq{"order_id": oid, "lease_owner": owner}).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate schedule query for order %s: %v", oid, err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed execute schedule query for order %s: %v", oid, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed get count of the affected rows: %v", err)
+	}
+
+	if n != 1 {
+		return fmt.Errorf("lease of order %s is lost by %s", oid, owner)
+	}
+
+	return nil
+}
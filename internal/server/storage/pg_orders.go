@@ -16,8 +16,9 @@ type (
 	Order                struct {
 		Number     string      `json:"number"`
 		Status     OrderStatus `json:"status"`
-		Accrual    float64     `json:"accrual,omitempty"`
+		Accrual    Points      `json:"accrual,omitempty"`
 		UploadedAt time.Time   `json:"uploaded_at"`
+		UpdatedAt  time.Time   `json:"-"`
 	}
 )
 
@@ -36,6 +37,11 @@ const (
 	OrderOperationFailed
 )
 
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrOrderForeign  = errors.New("order belongs to other user")
+)
+
 func (s *PGStorage) AddOrder(ctx context.Context, oid, login string) (OrderOperationResult, error) {
 	query, args, err := sq.Select("login").From(ordersTable).Where(sq.Eq{"order_id": oid}).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
@@ -57,7 +63,7 @@ func (s *PGStorage) AddOrder(ctx context.Context, oid, login string) (OrderOpera
 		return OrderAddByOther, errors.New("order upload by other")
 	}
 
-	if err != sql.ErrNoRows {
+	if !errors.Is(err, sql.ErrNoRows) {
 		return OrderOperationFailed, fmt.Errorf("failed check order %s: %v", oid, err)
 	}
 
@@ -69,13 +75,13 @@ func (s *PGStorage) AddOrder(ctx context.Context, oid, login string) (OrderOpera
 		return OrderOperationFailed, fmt.Errorf("failed generate insert order query for order %s: %v", oid, err)
 	}
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return OrderOperationFailed, fmt.Errorf("failed init DB transaction: %v", err)
 	}
 	defer tx.Rollback()
 
-	result, err := tx.Exec(query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return OrderOperationFailed, fmt.Errorf("failed execute insert query: %v", err)
 	}
@@ -89,6 +95,11 @@ func (s *PGStorage) AddOrder(ctx context.Context, oid, login string) (OrderOpera
 		return OrderOperationFailed, fmt.Errorf("affected %d rows instead 1", n)
 	}
 
+	err = insertOrderEvent(ctx, tx, oid, &OrderEvent{To: OrderStatusNew, Source: EventSourceUser, CreatedAt: time.Now()})
+	if err != nil {
+		return OrderOperationFailed, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return OrderOperationFailed, fmt.Errorf("failed commit query result: %v", err)
 	}
@@ -96,23 +107,160 @@ func (s *PGStorage) AddOrder(ctx context.Context, oid, login string) (OrderOpera
 	return OrderAddSuccess, nil
 }
 
-func (s *PGStorage) GetOrders(ctx context.Context, login string) ([]*Order, error) {
+// AddOrders uploads the batch of orders of the login in one transaction.
+// Every number gets the result of AddOrder, a number repeated in the batch is OrderAddBefore.
+func (s *PGStorage) AddOrders(ctx context.Context, oids []string, login string) ([]OrderOperationResult, error) {
+	results := make([]OrderOperationResult, len(oids))
+	unique := uniqueOrders(oids, results)
+	if len(unique) == 0 {
+		return results, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed init DB transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(time.DateTime)
+	insert := sq.Insert(ordersTable).Columns("order_id", "login", "status", "date_upload", "date_update")
+	for _, oid := range unique {
+		insert = insert.Values(oid, login, OrderStatusNew, now, now)
+	}
+
+	query, args, err := insert.Suffix("ON CONFLICT (order_id) DO NOTHING RETURNING order_id, login").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate insert orders query for login %s: %v", login, err)
+	}
+
+	inserted, err := queryOrderLogins(ctx, tx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed insert orders for login %s: %v", login, err)
+	}
+
+	rest := make([]string, 0)
+	for _, oid := range unique {
+		if _, ok := inserted[oid]; !ok {
+			rest = append(rest, oid)
+		}
+	}
+
+	owners := make(map[string]string)
+	if len(rest) > 0 {
+		query, args, err = sq.Select("order_id", "login").From(ordersTable).
+			Where(sq.Eq{"order_id": rest}).PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("failed generate select owners query for login %s: %v", login, err)
+		}
+
+		owners, err = queryOrderLogins(ctx, tx, query, args)
+		if err != nil {
+			return nil, fmt.Errorf("failed get owners of orders: %v", err)
+		}
+	}
+
+	if len(inserted) > 0 {
+		events := sq.Insert(orderEventsTable).Columns("order_id", "status_from", "status_to", "source", "created_at")
+		for _, oid := range unique {
+			if _, ok := inserted[oid]; ok {
+				events = events.Values(oid, nil, OrderStatusNew, EventSourceUser, time.Now())
+			}
+		}
+
+		query, args, err = events.PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("failed generate insert events query for login %s: %v", login, err)
+		}
+
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed execute insert events query for login %s: %v", login, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed commit query result: %v", err)
+	}
+
+	for i, oid := range oids {
+		if results[i] == OrderAddBefore {
+			continue
+		}
+
+		if _, ok := inserted[oid]; ok {
+			results[i] = OrderAddSuccess
+			continue
+		}
+
+		results[i] = OrderAddByOther
+		if owners[oid] == login {
+			results[i] = OrderAddBefore
+		}
+	}
+
+	return results, nil
+}
+
+// uniqueOrders returns the numbers of the batch without repeats and marks the repeats as OrderAddBefore.
+func uniqueOrders(oids []string, results []OrderOperationResult) []string {
+	seen := make(map[string]bool, len(oids))
+	unique := make([]string, 0, len(oids))
+	for i, oid := range oids {
+		if seen[oid] {
+			results[i] = OrderAddBefore
+			continue
+		}
+
+		seen[oid] = true
+		results[i] = OrderOperationFailed
+		unique = append(unique, oid)
+	}
+
+	return unique
+}
+
+// queryOrderLogins runs the query returning the order numbers with their logins.
+func queryOrderLogins(ctx context.Context, tx *sql.Tx, query string, args []interface{}) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logins := make(map[string]string)
+	for rows.Next() {
+		var oid, login string
+		if err = rows.Scan(&oid, &login); err != nil {
+			return nil, err
+		}
+
+		logins[oid] = login
+	}
+
+	return logins, rows.Err()
+}
+
+// GetOrders returns the orders of the login narrowed by the filter and the cursor of the next page.
+func (s *PGStorage) GetOrders(ctx context.Context, login string, filter *ListFilter) ([]*Order, string, error) {
 	orders := make([]*Order, 0)
-	query, args, err := sq.Select("order_id", "status", "date_upload", "accrual").From(ordersTable).
-		Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
+	query, args, err := applyListFilter(
+		sq.Select("order_id", "status", "date_upload", "accrual").From(ordersTable).Where(sq.Eq{"login": login}),
+		filter, "date_upload", "order_id",
+	).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed generate select orders query for login %s: %v", login, err)
+		return nil, "", fmt.Errorf("failed generate select orders query for login %s: %v", login, err)
 	}
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed execute select orders query for login %s: %v", login, err)
+		return nil, "", fmt.Errorf("failed execute select orders query for login %s: %v", login, err)
 	}
+	defer rows.Close()
+
 	for rows.Next() {
 		var oid string
 		var status OrderStatus
 		var upload time.Time
-		var accrual float64
+		var accrual Points
 
 		err = rows.Scan(&oid, &status, &upload, &accrual)
 		order := &Order{
@@ -128,10 +276,41 @@ func (s *PGStorage) GetOrders(ctx context.Context, login string) ([]*Order, erro
 	}
 
 	if rows.Err() != nil {
-		return nil, fmt.Errorf("error scan orders rows for login %s: %v", login, err)
+		return nil, "", fmt.Errorf("error scan orders rows for login %s: %v", login, err)
 	}
 
-	return orders, nil
+	count, next := nextPage(len(orders), filter, func(i int) *Cursor {
+		return &Cursor{Time: orders[i].UploadedAt, ID: orders[i].Number}
+	})
+
+	return orders[:count], next, nil
+}
+
+// GetOrder returns the order of the login.
+// The unknown order is ErrOrderNotFound, the order of another login is ErrOrderForeign.
+func (s *PGStorage) GetOrder(ctx context.Context, oid, login string) (*Order, error) {
+	query, args, err := sq.Select("login", "status", "accrual", "date_upload", "date_update").From(ordersTable).
+		Where(sq.Eq{"order_id": oid}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select order query for order %s: %v", oid, err)
+	}
+
+	var own string
+	order := &Order{Number: oid}
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&own, &order.Status, &order.Accrual, &order.UploadedAt, &order.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, oid)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed get order %s: %v", oid, err)
+	}
+
+	if own != login {
+		return nil, fmt.Errorf("%w: %s", ErrOrderForeign, oid)
+	}
+
+	return order, nil
 }
 
 func (s *PGStorage) GetUnprocessedOrders(ctx context.Context) ([]*Order, error) {
@@ -168,23 +347,44 @@ func (s *PGStorage) GetUnprocessedOrders(ctx context.Context) ([]*Order, error)
 	return orders, nil
 }
 
-func (s *PGStorage) UpdateOrder(ctx context.Context, order *Order) error {
-	query, args, err := sq.Select("status", "login").From(ordersTable).
-		Where(sq.Eq{"order_id": order.Number}).PlaceholderFormat(sq.Dollar).ToSql()
+// CountUnprocessedOrders counts the orders in the database without loading them.
+func (s *PGStorage) CountUnprocessedOrders(ctx context.Context) (int, error) {
+	query, args, err := sq.Select("COUNT(*)").From(ordersTable).
+		Where(sq.Eq{"status": []OrderStatus{OrderStatusNew, OrderStatusProcessing}}).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
-		return fmt.Errorf("failed generate select status query for order %s: %v", order.Number, err)
+		return 0, fmt.Errorf("failed generate count unprocessed orders query: %v", err)
 	}
 
-	row := s.db.QueryRowContext(ctx, query, args...)
-	if row.Err() != nil {
-		return fmt.Errorf("failed execute select status query for order %s: %v", order.Number, err)
+	var count int
+	if err = s.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed execute count unprocessed orders query: %v", err)
+	}
+
+	return count, nil
+}
+
+// UpdateOrder moves the order to the new status and credits the accrual in one transaction.
+// The order row is locked for the whole update and the credit is guarded
+// by the unique accrual ledger record of the order, so repeated updates never credit twice.
+// The same status is a no-op, a transition outside of the state machine is ErrOrderTransition.
+func (s *PGStorage) UpdateOrder(ctx context.Context, order *Order, source OrderEventSource) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed init DB transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := sq.Select("status", "login").From(ordersTable).
+		Where(sq.Eq{"order_id": order.Number}).Suffix("FOR UPDATE").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate select status query for order %s: %v", order.Number, err)
 	}
 
 	var status OrderStatus
 	var login string
-	err = row.Scan(&status, &login)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("order %s not found", order.Number)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&status, &login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrOrderNotFound, order.Number)
 	}
 
 	if err != nil {
@@ -192,34 +392,26 @@ func (s *PGStorage) UpdateOrder(ctx context.Context, order *Order) error {
 	}
 
 	if status == order.Status {
-		return fmt.Errorf("order %s status not changed", order.Number)
+		return nil
 	}
 
-	query, args, err = sq.Update(ordersTable).Set("status", order.Status).Set("date_update", order.UploadedAt).
-		Where(sq.Eq{"order_id": order.Number}).PlaceholderFormat(sq.Dollar).ToSql()
-	if err != nil {
-		return fmt.Errorf("failed generate update query for order %s: %v", order.Number, err)
+	if !status.CanTransit(order.Status) {
+		return fmt.Errorf("%w: order %s from %s to %s", ErrOrderTransition, order.Number, status, order.Status)
 	}
 
+	update := sq.Update(ordersTable).Set("status", order.Status).Set("date_update", order.UploadedAt)
 	if order.Status == OrderStatusProcessed {
-		query, args, err = sq.Update(ordersTable).
-			Set("status", order.Status).Set("accrual", order.Accrual).Set("date_update", order.UploadedAt).
-			Where(sq.Eq{"order_id": order.Number}).PlaceholderFormat(sq.Dollar).ToSql()
-		if err != nil {
-			return fmt.Errorf("failed generate update query for order %s: %v", order.Number, err)
-		}
+		update = update.Set("accrual", order.Accrual)
 	}
 
-	tx, err := s.db.Begin()
+	query, args, err = update.Where(sq.Eq{"order_id": order.Number}).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
-		return fmt.Errorf("failed init DB transaction: %v", err)
+		return fmt.Errorf("failed generate update query for order %s: %v", order.Number, err)
 	}
-	defer tx.Rollback()
 
-	result, err := tx.Exec(query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
-
-		return fmt.Errorf("failed execute insert query: %v", err)
+		return fmt.Errorf("failed execute update query: %v", err)
 	}
 
 	n, err := result.RowsAffected()
@@ -231,43 +423,78 @@ func (s *PGStorage) UpdateOrder(ctx context.Context, order *Order) error {
 		return fmt.Errorf("affected %d rows instead 1", n)
 	}
 
-	if order.Status == OrderStatusProcessed {
-		query, args, err := sq.Select("current").From(balanceTable).
-			Where(sq.Eq{"login": login}).Suffix("FOR UPDATE").
-			PlaceholderFormat(sq.Dollar).ToSql()
+	err = insertOrderEvent(ctx, tx, order.Number, &OrderEvent{From: status, To: order.Status, Source: source, CreatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	if order.Status == OrderStatusProcessed && order.Accrual > 0 {
+		err = creditAccrual(ctx, tx, login, order.Number, order.Accrual)
 		if err != nil {
-			return fmt.Errorf("failed generate select balance query for login %s: %v", login, err)
+			return fmt.Errorf("failed credit accrual of order %s to login %s: %v", order.Number, login, err)
 		}
+	}
 
-		row := s.db.QueryRowContext(ctx, query, args...)
-		if row.Err() != nil {
-			return fmt.Errorf("failed execute select balance query for login %s: %v", login, err)
-		}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed commit query result: %v", err)
+	}
 
-		var current float64
-		err = row.Scan(&current)
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("balance for login %s not found", login)
-		}
+	return nil
+}
 
-		if err != nil {
-			return fmt.Errorf("failed get current balance for login %s: %v", login, err)
-		}
+// GetOrderEvents returns the transitions of the order of the login from the oldest one.
+func (s *PGStorage) GetOrderEvents(ctx context.Context, oid, login string) ([]*OrderEvent, error) {
+	query, args, err := sq.Select("e.status_from", "e.status_to", "e.source", "e.created_at").
+		From(orderEventsTable + " e").
+		Join(ordersTable + " o USING (order_id)").
+		Where(sq.Eq{"e.order_id": oid, "o.login": login}).
+		OrderBy("e.event_id").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select events query for order %s: %v", oid, err)
+	}
 
-		query, args, err = sq.Update(balanceTable).Set("current", current+order.Accrual).
-			Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
-		if err != nil {
-			return fmt.Errorf("failed generate update balance query for login %s: %v", login, err)
-		}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute select events query for order %s: %v", oid, err)
+	}
+	defer rows.Close()
 
-		_, err = s.db.ExecContext(ctx, query, args...)
+	events := make([]*OrderEvent, 0)
+	for rows.Next() {
+		var from sql.NullString
+		event := &OrderEvent{}
+		err = rows.Scan(&from, &event.To, &event.Source, &event.CreatedAt)
 		if err != nil {
-			return fmt.Errorf("failed execute update balance query for login %s: %v", login, err)
+			return nil, fmt.Errorf("failed scan event of order %s: %v", oid, err)
 		}
+		event.From = OrderStatus(from.String)
+
+		events = append(events, event)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed commit query result: %v", err)
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan events rows of order %s: %v", oid, rows.Err())
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, oid)
+	}
+
+	return events, nil
+}
+
+func insertOrderEvent(ctx context.Context, tx *sql.Tx, oid string, event *OrderEvent) error {
+	from := sql.NullString{String: string(event.From), Valid: event.From != ""}
+	query, args, err := sq.Insert(orderEventsTable).Columns("order_id", "status_from", "status_to", "source", "created_at").
+		Values(oid, from, event.To, event.Source, event.CreatedAt).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate insert event query for order %s: %v", oid, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed execute insert event query for order %s: %v", oid, err)
 	}
 
 	return nil
@@ -0,0 +1,217 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type (
+	SessionOperationResult int
+	Session                struct {
+		ID         string    `json:"id"`
+		Login      string    `json:"-"`
+		UserAgent  string    `json:"user_agent,omitempty"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+	}
+)
+
+const (
+	sessionsTable = "gophmarkt.sessions"
+
+	SessionSuccess SessionOperationResult = iota
+	SessionNotFound
+	SessionRevoked
+	SessionExpired
+	SessionRefreshReused
+	SessionOperationFailed
+)
+
+func (s *PGStorage) AddSession(ctx context.Context, session *Session, refreshHash string) error {
+	query, args, err := sq.Insert(sessionsTable).
+		Columns("session_id", "login", "refresh_hash", "user_agent", "created_at", "updated_at", "expires_at").
+		Values(session.ID, session.Login, refreshHash, session.UserAgent, session.CreatedAt, session.LastUsedAt, session.ExpiresAt).
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate insert session query for login %s: %v", session.Login, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed execute insert session query for login %s: %v", session.Login, err)
+	}
+
+	return nil
+}
+
+// RotateSession replaces the refresh token hash of the session.
+// Presenting an already rotated refresh token revokes the whole session.
+func (s *PGStorage) RotateSession(ctx context.Context, sid, oldHash, newHash string, expiresAt time.Time) (*Session, SessionOperationResult, error) {
+	query, args, err := sq.Select("login", "refresh_hash", "user_agent", "created_at", "expires_at", "revoked_at").
+		From(sessionsTable).Where(sq.Eq{"session_id": sid}).Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, SessionOperationFailed, fmt.Errorf("failed generate select session query for session %s: %v", sid, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, SessionOperationFailed, fmt.Errorf("failed init DB transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var login, hash, userAgent string
+	var createdAt, oldExpiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&login, &hash, &userAgent, &createdAt, &oldExpiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, SessionNotFound, fmt.Errorf("session %s not found", sid)
+	}
+
+	if err != nil {
+		return nil, SessionOperationFailed, fmt.Errorf("failed get session %s: %v", sid, err)
+	}
+
+	now := time.Now()
+	if revokedAt.Valid {
+		return nil, SessionRevoked, fmt.Errorf("session %s is revoked", sid)
+	}
+
+	if oldExpiresAt.Before(now) {
+		return nil, SessionExpired, fmt.Errorf("session %s is expired", sid)
+	}
+
+	if hash != oldHash {
+		query, args, err = sq.Update(sessionsTable).Set("revoked_at", now).
+			Where(sq.Eq{"session_id": sid}).PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			return nil, SessionOperationFailed, fmt.Errorf("failed generate revoke session query for session %s: %v", sid, err)
+		}
+
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, SessionOperationFailed, fmt.Errorf("failed execute revoke session query for session %s: %v", sid, err)
+		}
+
+		if err = tx.Commit(); err != nil {
+			return nil, SessionOperationFailed, fmt.Errorf("failed commit query result: %v", err)
+		}
+
+		return nil, SessionRefreshReused, fmt.Errorf("refresh token of session %s is reused", sid)
+	}
+
+	query, args, err = sq.Update(sessionsTable).
+		Set("refresh_hash", newHash).Set("updated_at", now).Set("expires_at", expiresAt).
+		Where(sq.Eq{"session_id": sid}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, SessionOperationFailed, fmt.Errorf("failed generate rotate session query for session %s: %v", sid, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, SessionOperationFailed, fmt.Errorf("failed execute rotate session query for session %s: %v", sid, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, SessionOperationFailed, fmt.Errorf("failed commit query result: %v", err)
+	}
+
+	return &Session{
+		ID:         sid,
+		Login:      login,
+		UserAgent:  userAgent,
+		CreatedAt:  createdAt,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt,
+	}, SessionSuccess, nil
+}
+
+func (s *PGStorage) CheckSession(ctx context.Context, sid, login string) (SessionOperationResult, error) {
+	query, args, err := sq.Select("expires_at", "revoked_at").From(sessionsTable).
+		Where(sq.Eq{"session_id": sid, "login": login}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return SessionOperationFailed, fmt.Errorf("failed generate select session query for session %s: %v", sid, err)
+	}
+
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(&expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SessionNotFound, fmt.Errorf("session %s not found", sid)
+	}
+
+	if err != nil {
+		return SessionOperationFailed, fmt.Errorf("failed get session %s: %v", sid, err)
+	}
+
+	if revokedAt.Valid {
+		return SessionRevoked, fmt.Errorf("session %s is revoked", sid)
+	}
+
+	if expiresAt.Before(time.Now()) {
+		return SessionExpired, fmt.Errorf("session %s is expired", sid)
+	}
+
+	return SessionSuccess, nil
+}
+
+// GetSessions returns active sessions of the login.
+func (s *PGStorage) GetSessions(ctx context.Context, login string) ([]*Session, error) {
+	sessions := make([]*Session, 0)
+	query, args, err := sq.Select("session_id", "user_agent", "created_at", "updated_at", "expires_at").From(sessionsTable).
+		Where(sq.Eq{"login": login, "revoked_at": nil}).Where(sq.Gt{"expires_at": time.Now()}).
+		OrderBy("created_at DESC").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select sessions query for login %s: %v", login, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute select sessions query for login %s: %v", login, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session := &Session{Login: login}
+		err = rows.Scan(&session.ID, &session.UserAgent, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan session row for login %s: %v", login, err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error scan sessions rows for login %s: %v", login, rows.Err())
+	}
+
+	return sessions, nil
+}
+
+func (s *PGStorage) RevokeSession(ctx context.Context, sid, login string) (SessionOperationResult, error) {
+	query, args, err := sq.Update(sessionsTable).Set("revoked_at", time.Now()).
+		Where(sq.Eq{"session_id": sid, "login": login, "revoked_at": nil}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return SessionOperationFailed, fmt.Errorf("failed generate revoke session query for session %s: %v", sid, err)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return SessionOperationFailed, fmt.Errorf("failed execute revoke session query for session %s: %v", sid, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return SessionOperationFailed, fmt.Errorf("failed get count of the affected rows: %v", err)
+	}
+
+	if n == 0 {
+		return SessionNotFound, fmt.Errorf("active session %s not found", sid)
+	}
+
+	return SessionSuccess, nil
+}
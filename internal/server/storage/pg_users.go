@@ -46,12 +46,17 @@ func (s *PGStorage) AddUser(ctx context.Context, login, password string) (UserOp
 		return UserOperationFailed, fmt.Errorf("failed check login %s: %v", login, err)
 	}
 
-	query, args, err = sq.Insert(usersTable).Columns("login", "password").Values(login, password).PlaceholderFormat(sq.Dollar).ToSql()
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return UserOperationFailed, fmt.Errorf("failed hash password for login %s: %v", login, err)
+	}
+
+	query, args, err = sq.Insert(usersTable).Columns("login", "password").Values(login, hash).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return UserOperationFailed, fmt.Errorf("failed generate select login, password query for login %s: %v", login, err)
 	}
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return UserOperationFailed, fmt.Errorf("failed init DB transaction: %v", err)
 	}
@@ -76,7 +81,7 @@ func (s *PGStorage) AddUser(ctx context.Context, login, password string) (UserOp
 		return UserOperationFailed, fmt.Errorf("failed generate init balance query for login %s: %v", login, err)
 	}
 
-	_, err = s.db.ExecContext(ctx, query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return UserOperationFailed, fmt.Errorf("failed execute init balance query for login %s: %v", login, err)
 	}
@@ -110,13 +115,46 @@ func (s *PGStorage) CheckUser(ctx context.Context, login, password string) (User
 		return UserOperationFailed, fmt.Errorf("failed check login %s: %v", login, err)
 	}
 
-	if password != pass {
+	ok, rehash, err := checkPassword(s.hasher, pass, password)
+	if err != nil {
+		return UserOperationFailed, fmt.Errorf("failed check password for login %s: %v", login, err)
+	}
+
+	if !ok {
 		return UserPasswordWrong, errors.New("wrong password")
 	}
 
+	if rehash {
+		// the login must not fail because of the upgrade, the next login will retry it
+		if err := s.rehashPassword(ctx, login, pass, password); err != nil {
+			s.logger.Sugar().Warnf("failed upgrade password hash: %v", err)
+		}
+	}
+
 	return UserExist, nil
 }
 
+// rehashPassword replaces a legacy or outdated stored password with a fresh hash.
+func (s *PGStorage) rehashPassword(ctx context.Context, login, stored, password string) error {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("failed hash password for login %s: %v", login, err)
+	}
+
+	query, args, err := sq.Update(usersTable).Set("password", hash).
+		Where(sq.Eq{"login": login, "password": stored}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate update password query for login %s: %v", login, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed execute update password query for login %s: %v", login, err)
+	}
+
+	return nil
+}
+
 func validatePassword(password string) bool {
 	if len(password) < 4 {
 		return false
@@ -3,6 +3,7 @@ package gophmarktstorage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,7 +14,7 @@ type (
 	DrawalOperationResult int
 	Drawal                struct {
 		Order       string    `json:"order"`
-		Sum         float64   `json:"sum"`
+		Sum         Points    `json:"sum"`
 		ProcessedAt time.Time `json:"processed_at,omitempty"`
 	}
 )
@@ -29,47 +30,58 @@ const (
 	DrawalOperationFailed
 )
 
-func (s *PGStorage) AddDrawal(ctx context.Context, oid, login string, count float64) (DrawalOperationResult, error) {
-	query, args, err := sq.Select("login").From(drawalTable).Where(sq.Eq{"order_id": oid}).PlaceholderFormat(sq.Dollar).ToSql()
-	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed generate select drawal login query for order %s: %v", oid, err)
+// AddDrawal runs the whole withdrawal in one transaction.
+// The balance row lock serializes concurrent withdrawals of the login,
+// the balance check constraint is the last line of defence against an overdraft.
+func (s *PGStorage) AddDrawal(ctx context.Context, oid, login string, count Points) (DrawalOperationResult, error) {
+	if count <= 0 {
+		return DrawalAddError, fmt.Errorf("invalid drawal sum %v for order %s", count, oid)
 	}
 
-	row := s.db.QueryRowContext(ctx, query, args...)
-	if row.Err() != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed execute select drawal login query for order %s: %v", oid, err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return DrawalOperationFailed, fmt.Errorf("failed init DB transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	var own string
-	err = row.Scan(&own)
-	if err != sql.ErrNoRows {
-		if own == login {
-			return DrawalAddBefore, fmt.Errorf("Drawal by order %s already upload", oid)
-		}
+	query, args, err := sq.Select("current").
+		From(balanceTable).Where(sq.Eq{"login": login}).Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return DrawalOperationFailed, fmt.Errorf("failed generate select balance query for login %s: %v", login, err)
+	}
 
-		return DrawalAddByOther, fmt.Errorf("Drawal by order %s upload by other", oid)
+	var current Points
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DrawalOperationFailed, fmt.Errorf("no balance for login %s", login)
 	}
 
-	// if err != nil {
-	// 	return DrawalOperationFailed, fmt.Errorf("failed check drawal order %s: %v", oid, err)
-	// }
+	if err != nil {
+		return DrawalOperationFailed, fmt.Errorf("failed get balance for login %s: %v", login, err)
+	}
 
-	now := time.Now().Format(time.DateTime)
-	// now := time.Now().Format(time.RFC3339)
-	query, args, err = sq.Insert(drawalTable).Columns("order_id", "login", "count", "offdate").Values(oid, login, count, now).PlaceholderFormat(sq.Dollar).ToSql()
+	status, err := s.checkDrawalOwner(ctx, tx, oid, login)
 	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed generate insert order query for order %s: %v", oid, err)
+		return status, err
+	}
+
+	if count > current {
+		return DrawalNotEnoughPoints, fmt.Errorf("not enough points on balance for login %s", login)
 	}
 
-	tx, err := s.db.Begin()
+	now := time.Now().Format(time.DateTime)
+	// now := time.Now().Format(time.RFC3339)
+	query, args, err = sq.Insert(drawalTable).Columns("order_id", "login", "count", "offdate").
+		Values(oid, login, count, now).Suffix("ON CONFLICT (order_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed init DB transaction: %v", err)
+		return DrawalOperationFailed, fmt.Errorf("failed generate insert drawal query for order %s: %v", oid, err)
 	}
-	defer tx.Rollback()
 
-	result, err := tx.Exec(query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed execute insert query: %v", err)
+		return DrawalOperationFailed, fmt.Errorf("failed execute insert drawal query for order %s: %v", oid, err)
 	}
 
 	n, err := result.RowsAffected()
@@ -77,67 +89,82 @@ func (s *PGStorage) AddDrawal(ctx context.Context, oid, login string, count floa
 		return DrawalOperationFailed, fmt.Errorf("failed get count of the affected rows: %v", err)
 	}
 
+	// the same order was committed by a concurrent withdrawal of another login
 	if n != 1 {
+		status, err = s.checkDrawalOwner(ctx, tx, oid, login)
+		if err != nil {
+			return status, err
+		}
+
 		return DrawalOperationFailed, fmt.Errorf("affected %d rows instead 1", n)
 	}
 
-	query, args, err = sq.Select("current", "withdrawn").
-		From(balanceTable).Where(sq.Eq{"login": login}).Suffix("FOR UPDATE").
-		PlaceholderFormat(sq.Dollar).ToSql()
-	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed generate select balance with drawn query for login %s: %v", login, err)
+	err = postMovement(ctx, tx, &ledgerMovement{
+		kind:      LedgerWithdrawal,
+		login:     login,
+		amount:    -count,
+		order:     oid,
+		createdAt: time.Now(),
+	})
+	if isCheckViolation(err) {
+		return DrawalNotEnoughPoints, fmt.Errorf("not enough points on balance for login %s: %v", login, err)
 	}
 
-	row = s.db.QueryRowContext(ctx, query, args...)
-	if row.Err() != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed execute select balance with drawn query for login %s: %v", login, err)
+	if err != nil {
+		return DrawalOperationFailed, fmt.Errorf("failed debit drawal of order %s from login %s: %v", oid, login, err)
 	}
 
-	var current, withdrawn float64
-	err = row.Scan(&current, &withdrawn)
-	if err == sql.ErrNoRows {
-		return DrawalOperationFailed, fmt.Errorf("no balance for login %s: %v", login, err)
+	if err = tx.Commit(); err != nil {
+		return DrawalOperationFailed, fmt.Errorf("failed commit query result: %v", err)
 	}
 
-	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed get balance for login %s: %v", login, err)
-	}
+	return DrawalAddSuccess, nil
+}
 
-	if count > current {
-		return DrawalNotEnoughPoints, fmt.Errorf("not enough points on balance for login %s: %v", login, err)
+// checkDrawalOwner reports an already registered withdrawal by the order.
+func (s *PGStorage) checkDrawalOwner(ctx context.Context, tx *sql.Tx, oid, login string) (DrawalOperationResult, error) {
+	query, args, err := sq.Select("login").From(drawalTable).Where(sq.Eq{"order_id": oid}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return DrawalOperationFailed, fmt.Errorf("failed generate select drawal login query for order %s: %v", oid, err)
 	}
 
-	query, args, err = sq.Update(balanceTable).Set("current", current-count).Set("withdrawn", withdrawn+count).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
-	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed generate update balance with drawn query for login %s: %v", login, err)
+	var own string
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&own)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DrawalAddSuccess, nil
 	}
 
-	_, err = s.db.ExecContext(ctx, query, args...)
 	if err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed execute update balance with drawn query for login %s: %v", login, err)
+		return DrawalOperationFailed, fmt.Errorf("failed check drawal order %s: %v", oid, err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return DrawalOperationFailed, fmt.Errorf("failed commit query result: %v", err)
+	if own == login {
+		return DrawalAddBefore, fmt.Errorf("Drawal by order %s already upload", oid)
 	}
 
-	return DrawalAddSuccess, nil
+	return DrawalAddByOther, fmt.Errorf("Drawal by order %s upload by other", oid)
 }
 
-func (s *PGStorage) GetDrawals(ctx context.Context, login string) ([]*Drawal, error) {
+// GetDrawals returns the withdrawals of the login narrowed by the filter and the cursor of the next page.
+func (s *PGStorage) GetDrawals(ctx context.Context, login string, filter *ListFilter) ([]*Drawal, string, error) {
 	drawals := make([]*Drawal, 0)
-	query, args, err := sq.Select("order_id", "count", "offdate").From(drawalTable).Where(sq.Eq{"login": login}).PlaceholderFormat(sq.Dollar).ToSql()
+	query, args, err := applyListFilter(
+		sq.Select("order_id", "count", "offdate").From(drawalTable).Where(sq.Eq{"login": login}),
+		filter, "offdate", "order_id",
+	).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed generate select drawals query for login %s: %v", login, err)
+		return nil, "", fmt.Errorf("failed generate select drawals query for login %s: %v", login, err)
 	}
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed execute select drawals query for login %s: %v", login, err)
+		return nil, "", fmt.Errorf("failed execute select drawals query for login %s: %v", login, err)
 	}
+	defer rows.Close()
+
 	for rows.Next() {
 		var oid string
-		var sum float64
+		var sum Points
 		var processedAt time.Time
 
 		err = rows.Scan(&oid, &sum, &processedAt)
@@ -153,8 +180,12 @@ func (s *PGStorage) GetDrawals(ctx context.Context, login string) ([]*Drawal, er
 	}
 
 	if rows.Err() != nil {
-		return nil, fmt.Errorf("error scan drawals rows for login %s: %v", login, err)
+		return nil, "", fmt.Errorf("error scan drawals rows for login %s: %v", login, err)
 	}
 
-	return drawals, nil
+	count, next := nextPage(len(drawals), filter, func(i int) *Cursor {
+		return &Cursor{Time: drawals[i].ProcessedAt, ID: drawals[i].Order}
+	})
+
+	return drawals[:count], next, nil
 }
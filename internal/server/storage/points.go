@@ -0,0 +1,153 @@
+package gophmarktstorage
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Points is an amount of loyalty points kept in hundredths.
+// It is encoded in JSON as a plain number like 500.5 and stored as numeric.
+type Points int64
+
+const (
+	pointsScale    = 100
+	pointsDecimals = 2
+)
+
+// ParsePoints reads a decimal number exactly.
+// Digits beyond the hundredths are rounded half away from zero.
+func ParsePoints(value string) (Points, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return 0, fmt.Errorf("invalid points value %q", value)
+	}
+
+	rat.Mul(rat, big.NewRat(pointsScale, 1))
+
+	num := new(big.Int).Set(rat.Num())
+	denom := rat.Denom()
+	quo, rem := new(big.Int).QuoRem(num, denom, new(big.Int))
+	// |rem| * 2 >= denom means rounding away from zero
+	if rem.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(denom) >= 0 {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("points value %q is out of range", value)
+	}
+
+	return Points(quo.Int64()), nil
+}
+
+func PointsFromFloat(value float64) Points {
+	return Points(math.Round(value * pointsScale))
+}
+
+func (p Points) Float64() float64 {
+	return float64(p) / pointsScale
+}
+
+// String formats the points without trailing zeros: 500, 500.5, 729.98.
+func (p Points) String() string {
+	sign := ""
+	value := int64(p)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	whole := value / pointsScale
+	fraction := value % pointsScale
+	if fraction == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", pointsDecimals, fraction), "0")
+
+	return sign + strconv.FormatInt(whole, 10) + "." + digits
+}
+
+func (p Points) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Points) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		return fmt.Errorf("points value %s must be a number", value)
+	}
+
+	points, err := ParsePoints(value)
+	if err != nil {
+		return err
+	}
+
+	*p = points
+
+	return nil
+}
+
+func (p *Points) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!str" {
+		return fmt.Errorf("points value %q must be a number", node.Value)
+	}
+
+	points, err := ParsePoints(node.Value)
+	if err != nil {
+		return err
+	}
+
+	*p = points
+
+	return nil
+}
+
+// Scan reads numeric columns, NULL is zero points.
+func (p *Points) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*p = 0
+	case int64:
+		*p = Points(value * pointsScale)
+	case float64:
+		*p = PointsFromFloat(value)
+	case []byte:
+		points, err := ParsePoints(string(value))
+		if err != nil {
+			return err
+		}
+		*p = points
+	case string:
+		points, err := ParsePoints(value)
+		if err != nil {
+			return err
+		}
+		*p = points
+	default:
+		return fmt.Errorf("unsupported points source type %T", src)
+	}
+
+	return nil
+}
+
+// Value passes the points to the database as an exact decimal string.
+func (p Points) Value() (driver.Value, error) {
+	sign := ""
+	value := int64(p)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	return fmt.Sprintf("%s%d.%0*d", sign, value/pointsScale, pointsDecimals, value%pointsScale), nil
+}
@@ -0,0 +1,101 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	TypePostgres = "postgres"
+	TypeMemory   = "memory"
+)
+
+// Storage is the set of operations the loyalty service needs from a backend.
+type Storage interface {
+	// users
+	AddUser(ctx context.Context, login, password string) (UserOperationResult, error)
+	CheckUser(ctx context.Context, login, password string) (UserOperationResult, error)
+	// orders
+	AddOrder(ctx context.Context, oid, login string) (OrderOperationResult, error)
+	AddOrders(ctx context.Context, oids []string, login string) ([]OrderOperationResult, error)
+	GetOrders(ctx context.Context, login string, filter *ListFilter) ([]*Order, string, error)
+	GetOrder(ctx context.Context, oid, login string) (*Order, error)
+	GetUnprocessedOrders(ctx context.Context) ([]*Order, error)
+	CountUnprocessedOrders(ctx context.Context) (int, error)
+	UpdateOrder(ctx context.Context, order *Order, source OrderEventSource) error
+	GetOrderEvents(ctx context.Context, oid, login string) ([]*OrderEvent, error)
+	// order checks in the accrual system
+	ClaimOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]*OrderCheck, error)
+	ScheduleOrderCheck(ctx context.Context, oid, owner string, attempts, notRegistered int, next time.Time) error
+	// withdrawals
+	AddDrawal(ctx context.Context, oid, login string, count Points) (DrawalOperationResult, error)
+	GetDrawals(ctx context.Context, login string, filter *ListFilter) ([]*Drawal, string, error)
+	// balance
+	GetBalance(ctx context.Context, login string) (*Balance, error)
+	AddBalance(ctx context.Context, login string, count Points) error
+	DrawnBalance(ctx context.Context, login string, count Points) error
+	DropBalance(ctx context.Context, login string) error
+	// ledger
+	GetLedger(ctx context.Context, login string, limit, offset int) ([]*LedgerEntry, error)
+	ReverseTransaction(ctx context.Context, txID string) error
+	Reconcile(ctx context.Context) ([]*BalanceMismatch, error)
+	GetLedgerTotals(ctx context.Context) (*LedgerTotals, error)
+	// sessions
+	AddSession(ctx context.Context, session *Session, refreshHash string) error
+	RotateSession(ctx context.Context, sid, oldHash, newHash string, expiresAt time.Time) (*Session, SessionOperationResult, error)
+	CheckSession(ctx context.Context, sid, login string) (SessionOperationResult, error)
+	GetSessions(ctx context.Context, login string) ([]*Session, error)
+	RevokeSession(ctx context.Context, sid, login string) (SessionOperationResult, error)
+
+	Close() error
+}
+
+var (
+	_ Storage = (*PGStorage)(nil)
+	_ Storage = (*MemStorage)(nil)
+)
+
+// businessErrors are the expected results of the operations without a result code.
+var businessErrors = []error{
+	ErrOrderNotFound,
+	ErrOrderForeign,
+	ErrOrderTransition,
+	ErrInvalidCursor,
+}
+
+// IsFailure reports whether the error is a failure of the backend and not an expected business result.
+// The operations with a result code are classified by its Failed method.
+func IsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, expected := range businessErrors {
+		if errors.Is(err, expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Failed reports whether the operation failed in the backend.
+func (r UserOperationResult) Failed() bool {
+	return r == UserOperationFailed
+}
+
+// Failed reports whether the operation failed in the backend.
+func (r OrderOperationResult) Failed() bool {
+	return r == OrderOperationFailed
+}
+
+// Failed reports whether the operation failed in the backend.
+func (r DrawalOperationResult) Failed() bool {
+	return r == DrawalOperationFailed
+}
+
+// Failed reports whether the operation failed in the backend.
+func (r SessionOperationResult) Failed() bool {
+	return r == SessionOperationFailed
+}
@@ -0,0 +1,45 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMemCheckUserUpgradesLegacyPassword(t *testing.T) {
+	const (
+		login    = "legacy"
+		password = "Passw0rd"
+		logins   = 4
+	)
+
+	s := newTestMemStorage(t)
+	s.users[login] = password
+	s.balances[login] = &Balance{}
+
+	results := make([]UserOperationResult, logins)
+	var wg sync.WaitGroup
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = s.CheckUser(context.Background(), login, password)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result != UserExist {
+			t.Errorf("login %d: result %d, want %d", i, result, UserExist)
+		}
+	}
+
+	if hash := s.users[login]; !strings.HasPrefix(hash, bcryptPrefix) {
+		t.Errorf("stored password %q is not upgraded to bcrypt", hash)
+	}
+
+	if result, _ := s.CheckUser(context.Background(), login, "wrong"); result != UserPasswordWrong {
+		t.Errorf("wrong password: result %d, want %d", result, UserPasswordWrong)
+	}
+}
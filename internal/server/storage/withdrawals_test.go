@@ -0,0 +1,88 @@
+package gophmarktstorage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddDrawalConcurrently(t *testing.T) {
+	testAddDrawalConcurrently(t, newTestMemStorage(t))
+}
+
+func TestAddDrawalConcurrentlyPostgres(t *testing.T) {
+	testAddDrawalConcurrently(t, newTestPGStorage(t))
+}
+
+// testAddDrawalConcurrently fires more parallel withdrawals than the balance covers.
+// Exactly floor(balance/sum) of them must pass, the others are rejected and the balance never goes negative.
+func testAddDrawalConcurrently(t *testing.T, s Storage) {
+	const (
+		requests = 50
+		balance  = 1000
+		sum      = 30
+		// floor(balance/sum)
+		wantAccepted = balance / sum
+	)
+
+	ctx := context.Background()
+	// the names are unique for the runs against a long-living database
+	prefix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	login := "withdraw-" + prefix
+	if _, err := s.AddUser(ctx, login, "Passw0rd"); err != nil {
+		t.Fatalf("failed add user: %v", err)
+	}
+	if err := s.AddBalance(ctx, login, PointsFromFloat(balance)); err != nil {
+		t.Fatalf("failed add balance: %v", err)
+	}
+
+	results := make([]DrawalOperationResult, requests)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			results[i], _ = s.AddDrawal(ctx, fmt.Sprintf("%s%03d", prefix, i), login, PointsFromFloat(sum))
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	var accepted, rejected int
+	for i, result := range results {
+		switch result {
+		case DrawalAddSuccess:
+			accepted++
+		case DrawalNotEnoughPoints:
+			rejected++
+		default:
+			t.Errorf("withdrawal %d: result %d, want success or not enough points", i, result)
+		}
+	}
+
+	if accepted != wantAccepted {
+		t.Errorf("accepted %d withdrawals, want %d", accepted, wantAccepted)
+	}
+	if rejected != requests-wantAccepted {
+		t.Errorf("rejected %d withdrawals, want %d", rejected, requests-wantAccepted)
+	}
+
+	got, err := s.GetBalance(ctx, login)
+	if err != nil {
+		t.Fatalf("failed get balance: %v", err)
+	}
+	if got.Current < 0 {
+		t.Errorf("balance is %v, overdraft", got.Current)
+	}
+	if want := PointsFromFloat(float64(balance - accepted*sum)); got.Current != want {
+		t.Errorf("balance is %v, want %v", got.Current, want)
+	}
+	if want := PointsFromFloat(float64(accepted * sum)); got.Withdrawn != want {
+		t.Errorf("withdrawn %v, want %v", got.Withdrawn, want)
+	}
+}
@@ -0,0 +1,278 @@
+package gophmarkttracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	storage "github.com/zvfkjytytw/gophmarkt/internal/server/storage"
+)
+
+// OutcomeKey is the attribute of the business result of the storage operation.
+const OutcomeKey = attribute.Key("gophmarkt.outcome")
+
+// tracedStorage records a client span for every operation of the wrapped storage.
+type tracedStorage struct {
+	storage storage.Storage
+	system  attribute.KeyValue
+}
+
+// Storage wraps the storage with the spans of its methods, the system names the database in the spans.
+func Storage(appStorage storage.Storage, system string) storage.Storage {
+	return &tracedStorage{
+		storage: appStorage,
+		system:  semconv.DBSystemKey.String(system),
+	}
+}
+
+func (s *tracedStorage) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "storage."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(s.system, semconv.DBOperationName(method)),
+	)
+}
+
+// End closes the span with the error of the operation.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// end closes the span of the storage operation. Only the failures of the backend are errors,
+// the expected business results like a foreign order are kept in the outcome attribute.
+func end(span trace.Span, err error, failed bool) {
+	if err != nil && !failed {
+		span.SetAttributes(OutcomeKey.String(err.Error()))
+		err = nil
+	}
+	End(span, err)
+}
+
+func (s *tracedStorage) AddUser(ctx context.Context, login, password string) (storage.UserOperationResult, error) {
+	ctx, span := s.start(ctx, "AddUser")
+	result, err := s.storage.AddUser(ctx, login, password)
+	end(span, err, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *tracedStorage) CheckUser(ctx context.Context, login, password string) (storage.UserOperationResult, error) {
+	ctx, span := s.start(ctx, "CheckUser")
+	result, err := s.storage.CheckUser(ctx, login, password)
+	end(span, err, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *tracedStorage) AddOrder(ctx context.Context, oid, login string) (storage.OrderOperationResult, error) {
+	ctx, span := s.start(ctx, "AddOrder")
+	result, err := s.storage.AddOrder(ctx, oid, login)
+	end(span, err, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *tracedStorage) AddOrders(ctx context.Context, oids []string, login string) ([]storage.OrderOperationResult, error) {
+	ctx, span := s.start(ctx, "AddOrders")
+	result, err := s.storage.AddOrders(ctx, oids, login)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) GetOrders(ctx context.Context, login string, filter *storage.ListFilter) ([]*storage.Order, string, error) {
+	ctx, span := s.start(ctx, "GetOrders")
+	first, second, err := s.storage.GetOrders(ctx, login, filter)
+	end(span, err, storage.IsFailure(err))
+
+	return first, second, err
+}
+
+func (s *tracedStorage) GetOrder(ctx context.Context, oid, login string) (*storage.Order, error) {
+	ctx, span := s.start(ctx, "GetOrder")
+	result, err := s.storage.GetOrder(ctx, oid, login)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) GetUnprocessedOrders(ctx context.Context) ([]*storage.Order, error) {
+	ctx, span := s.start(ctx, "GetUnprocessedOrders")
+	result, err := s.storage.GetUnprocessedOrders(ctx)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) CountUnprocessedOrders(ctx context.Context) (int, error) {
+	ctx, span := s.start(ctx, "CountUnprocessedOrders")
+	result, err := s.storage.CountUnprocessedOrders(ctx)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) UpdateOrder(ctx context.Context, order *storage.Order, source storage.OrderEventSource) error {
+	ctx, span := s.start(ctx, "UpdateOrder")
+	err := s.storage.UpdateOrder(ctx, order, source)
+	end(span, err, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *tracedStorage) GetOrderEvents(ctx context.Context, oid, login string) ([]*storage.OrderEvent, error) {
+	ctx, span := s.start(ctx, "GetOrderEvents")
+	result, err := s.storage.GetOrderEvents(ctx, oid, login)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) ClaimOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]*storage.OrderCheck, error) {
+	ctx, span := s.start(ctx, "ClaimOrders")
+	result, err := s.storage.ClaimOrders(ctx, owner, limit, lease)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) ScheduleOrderCheck(ctx context.Context, oid, owner string, attempts, notRegistered int, next time.Time) error {
+	ctx, span := s.start(ctx, "ScheduleOrderCheck")
+	err := s.storage.ScheduleOrderCheck(ctx, oid, owner, attempts, notRegistered, next)
+	end(span, err, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *tracedStorage) AddDrawal(ctx context.Context, oid, login string, count storage.Points) (storage.DrawalOperationResult, error) {
+	ctx, span := s.start(ctx, "AddDrawal")
+	result, err := s.storage.AddDrawal(ctx, oid, login, count)
+	end(span, err, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *tracedStorage) GetDrawals(ctx context.Context, login string, filter *storage.ListFilter) ([]*storage.Drawal, string, error) {
+	ctx, span := s.start(ctx, "GetDrawals")
+	first, second, err := s.storage.GetDrawals(ctx, login, filter)
+	end(span, err, storage.IsFailure(err))
+
+	return first, second, err
+}
+
+func (s *tracedStorage) GetBalance(ctx context.Context, login string) (*storage.Balance, error) {
+	ctx, span := s.start(ctx, "GetBalance")
+	result, err := s.storage.GetBalance(ctx, login)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) AddBalance(ctx context.Context, login string, count storage.Points) error {
+	ctx, span := s.start(ctx, "AddBalance")
+	err := s.storage.AddBalance(ctx, login, count)
+	end(span, err, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *tracedStorage) DrawnBalance(ctx context.Context, login string, count storage.Points) error {
+	ctx, span := s.start(ctx, "DrawnBalance")
+	err := s.storage.DrawnBalance(ctx, login, count)
+	end(span, err, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *tracedStorage) DropBalance(ctx context.Context, login string) error {
+	ctx, span := s.start(ctx, "DropBalance")
+	err := s.storage.DropBalance(ctx, login)
+	end(span, err, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *tracedStorage) GetLedger(ctx context.Context, login string, limit, offset int) ([]*storage.LedgerEntry, error) {
+	ctx, span := s.start(ctx, "GetLedger")
+	result, err := s.storage.GetLedger(ctx, login, limit, offset)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) ReverseTransaction(ctx context.Context, txID string) error {
+	ctx, span := s.start(ctx, "ReverseTransaction")
+	err := s.storage.ReverseTransaction(ctx, txID)
+	end(span, err, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *tracedStorage) Reconcile(ctx context.Context) ([]*storage.BalanceMismatch, error) {
+	ctx, span := s.start(ctx, "Reconcile")
+	result, err := s.storage.Reconcile(ctx)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) GetLedgerTotals(ctx context.Context) (*storage.LedgerTotals, error) {
+	ctx, span := s.start(ctx, "GetLedgerTotals")
+	result, err := s.storage.GetLedgerTotals(ctx)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) AddSession(ctx context.Context, session *storage.Session, refreshHash string) error {
+	ctx, span := s.start(ctx, "AddSession")
+	err := s.storage.AddSession(ctx, session, refreshHash)
+	end(span, err, storage.IsFailure(err))
+
+	return err
+}
+
+func (s *tracedStorage) RotateSession(ctx context.Context, sid, oldHash, newHash string, expiresAt time.Time) (*storage.Session, storage.SessionOperationResult, error) {
+	ctx, span := s.start(ctx, "RotateSession")
+	first, second, err := s.storage.RotateSession(ctx, sid, oldHash, newHash, expiresAt)
+	end(span, err, err != nil && second.Failed())
+
+	return first, second, err
+}
+
+func (s *tracedStorage) CheckSession(ctx context.Context, sid, login string) (storage.SessionOperationResult, error) {
+	ctx, span := s.start(ctx, "CheckSession")
+	result, err := s.storage.CheckSession(ctx, sid, login)
+	end(span, err, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *tracedStorage) GetSessions(ctx context.Context, login string) ([]*storage.Session, error) {
+	ctx, span := s.start(ctx, "GetSessions")
+	result, err := s.storage.GetSessions(ctx, login)
+	end(span, err, storage.IsFailure(err))
+
+	return result, err
+}
+
+func (s *tracedStorage) RevokeSession(ctx context.Context, sid, login string) (storage.SessionOperationResult, error) {
+	ctx, span := s.start(ctx, "RevokeSession")
+	result, err := s.storage.RevokeSession(ctx, sid, login)
+	end(span, err, err != nil && result.Failed())
+
+	return result, err
+}
+
+func (s *tracedStorage) Close() error {
+	return s.storage.Close()
+}
+
+var _ storage.Storage = (*tracedStorage)(nil)
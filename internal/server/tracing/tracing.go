@@ -0,0 +1,126 @@
+// Package gophmarkttracing records the OpenTelemetry spans of the gophermart service.
+package gophmarkttracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+
+	serviceName = "gophermart"
+	// instrumentation name of the spans of the service
+	tracerName = "github.com/zvfkjytytw/gophmarkt"
+)
+
+type Config struct {
+	// none, stdout, file or otlp
+	Exporter string `yaml:"exporter"`
+	// file of the file exporter, the spans are appended as JSON lines
+	File string `yaml:"file"`
+	// URL of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* variables are used when it is empty
+	Endpoint string `yaml:"endpoint"`
+	// share of the new traces recorded, from 0 to 1
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Tracer returns the tracer of the service from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Provider exports the spans of the service, it is stopped after the other services to flush their spans.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	file     io.Closer
+}
+
+// NewProvider installs the global tracer provider and the W3C trace context propagation.
+// The none exporter keeps the spans unrecorded.
+func NewProvider(ctx context.Context, config *Config) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	p := &Provider{}
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterNone, "":
+		return p, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		file, fileErr := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if fileErr != nil {
+			return nil, fmt.Errorf("failed open trace file %s: %v", config.File, fileErr)
+		}
+		p.file = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	case ExporterOTLP:
+		options := make([]otlptracehttp.Option, 0, 1)
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %s", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed init %s trace exporter: %v", config.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed init trace resource: %v", err)
+	}
+
+	p.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(p.provider)
+
+	return p, nil
+}
+
+func (p *Provider) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop flushes the recorded spans.
+func (p *Provider) Stop(ctx context.Context) error {
+	if p.provider == nil {
+		return nil
+	}
+
+	if err := p.provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed shutdown tracer provider: %v", err)
+	}
+
+	if p.file != nil {
+		return p.file.Close()
+	}
+
+	return nil
+}